@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/expki/backend/pixel-protocol/config"
+	"github.com/expki/backend/pixel-protocol/metrics"
+	"github.com/expki/backend/pixel-protocol/server"
+)
+
+// adminRoutes registers the endpoints of the mutual TLS admin listener, each behind the role of its group
+func adminRoutes(mux *http.ServeMux, auth *server.AdminAuth, srv *server.Server, reload *reloader) {
+	// Metrics
+	mux.Handle("GET /metrics", auth.Require(config.AdminRoleMetrics, metrics.Handler()))
+
+	// Profiling, pprof.Index serves the named profiles such as heap and goroutine
+	mux.Handle("GET /debug/pprof/", auth.Require(config.AdminRoleDebug, http.HandlerFunc(pprof.Index)))
+	mux.Handle("GET /debug/pprof/cmdline", auth.Require(config.AdminRoleDebug, http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("GET /debug/pprof/profile", auth.Require(config.AdminRoleDebug, http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", auth.Require(config.AdminRoleDebug, http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("GET /debug/pprof/trace", auth.Require(config.AdminRoleDebug, http.HandlerFunc(pprof.Trace)))
+
+	// Moderation
+	moderationRoutes(mux, srv, func(h http.Handler) http.Handler { return auth.Require(config.AdminRoleModerator, h) })
+
+	// Config
+	mux.Handle("GET /config", auth.Require(config.AdminRoleConfig, http.HandlerFunc(reload.HandleConfig)))
+	mux.Handle("POST /config/reload", auth.Require(config.AdminRoleConfig, http.HandlerFunc(reload.HandleReload)))
+}
+
+// moderationRoutes registers the portrait moderation endpoints of the admin listener.
+// Without client certificates wrap passes the handlers through, they check the bearer token themselves.
+func moderationRoutes(mux *http.ServeMux, srv *server.Server, wrap func(http.Handler) http.Handler) {
+	mux.Handle("GET /admin/portraits", wrap(http.HandlerFunc(srv.HandleAdminPortraits)))
+	mux.Handle("GET /admin/portraits/{portraitId}/image", wrap(http.HandlerFunc(srv.HandleAdminPortraitImage)))
+	mux.Handle("POST /admin/portraits/{portraitId}/approve", wrap(http.HandlerFunc(srv.HandleAdminPortraitApprove)))
+	mux.Handle("POST /admin/portraits/{portraitId}/reject", wrap(http.HandlerFunc(srv.HandleAdminPortraitReject)))
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/google/uuid"
+)
+
+// Fight is the public representation of a fight.
+type Fight struct {
+	ID         uuid.UUID             `json:"ID"`
+	AttackerID uuid.UUID             `json:"AttackerID"`
+	Attacker   *Hero                 `json:"Attacker"`
+	DefenderID uuid.UUID             `json:"DefenderID"`
+	Defender   *Hero                 `json:"Defender"`
+	Timestamp  time.Time             `json:"Timestamp"`
+	Outcome    database.FightOutcome `json:"Outcome" description:"Fight outcome from attacker's perspective: 0=Draw, 1=Victory, 2=Defeat" enum:"0,1,2"`
+	Transcript string                `json:"Transcript" description:"AI-generated combat narrative describing the battle"`
+}
+
+// NewFight maps a database fight to its response representation.
+// Attacker and defender are only included when they were preloaded.
+func NewFight(fight database.Fight) Fight {
+	response := Fight{
+		ID:         fight.ID,
+		AttackerID: fight.AttackerID,
+		DefenderID: fight.DefenderID,
+		Timestamp:  fight.Timestamp,
+		Outcome:    fight.Outcome,
+		Transcript: fight.Transcript,
+	}
+	if fight.Attacker != nil {
+		attacker := NewHero(*fight.Attacker)
+		response.Attacker = &attacker
+	}
+	if fight.Defender != nil {
+		defender := NewHero(*fight.Defender)
+		response.Defender = &defender
+	}
+	return response
+}
+
+// NewFights maps a list of database fights to their response representation.
+func NewFights(fights []database.Fight) []Fight {
+	response := make([]Fight, 0, len(fights))
+	for _, fight := range fights {
+		response = append(response, NewFight(fight))
+	}
+	return response
+}
+
+// FightResult is returned after a fight has been fought.
+type FightResult struct {
+	Fight   Fight `json:"fight"`
+	Victory bool  `json:"victory"`
+	EloGain int32 `json:"elo_gain"`
+}
+
+// FightsResponse is a page of fights.
+type FightsResponse struct {
+	Fights     []Fight `json:"fights"`
+	HasMore    bool    `json:"has_more"`
+	NextCursor string  `json:"next_cursor,omitempty" format:"uuid"`
+}
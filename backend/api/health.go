@@ -0,0 +1,28 @@
+package api
+
+// Check statuses of the readiness probe
+const (
+	CheckOK       = "ok"
+	CheckFailed   = "failed"
+	CheckDraining = "draining"
+)
+
+// Readiness is the result of the readiness probe, it is only ready when every check passed.
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// Check is the outcome of a single readiness check.
+type Check struct {
+	Status string `json:"status" enum:"ok,failed,draining"`
+}
+
+// Version identifies the running build and configuration.
+type Version struct {
+	Commit            string `json:"commit"`
+	CommitTime        string `json:"commitTime,omitempty"`
+	Modified          bool   `json:"modified"`
+	GoVersion         string `json:"goVersion"`
+	ConfigFingerprint string `json:"configFingerprint"`
+}
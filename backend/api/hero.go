@@ -0,0 +1,48 @@
+package api
+
+import (
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/google/uuid"
+)
+
+// Hero is the public representation of a hero.
+type Hero struct {
+	ID          uuid.UUID  `json:"ID"`
+	Country     string     `json:"Country" example:"US"`
+	Elo         uint32     `json:"Elo" example:"1000"`
+	Title       string     `json:"Title"`
+	Description string     `json:"Description"`
+	PlayerID    uuid.UUID  `json:"PlayerID"`
+	Player      *Player    `json:"Player,omitempty"`
+	DeletedAt   *time.Time `json:"DeletedAt"`
+}
+
+// NewHero maps a database hero to its response representation.
+// The owning player is only included when it was preloaded.
+func NewHero(hero database.Hero) Hero {
+	response := Hero{
+		ID:          hero.ID,
+		Country:     hero.Country,
+		Elo:         hero.Elo,
+		Title:       hero.Title,
+		Description: hero.Description,
+		PlayerID:    hero.PlayerID,
+		DeletedAt:   hero.DeletedAt,
+	}
+	if hero.Player != nil {
+		player := NewPlayer(*hero.Player)
+		response.Player = &player
+	}
+	return response
+}
+
+// NewHeroes maps a list of database heroes to their response representation.
+func NewHeroes(heroes []database.Hero) []Hero {
+	response := make([]Hero, 0, len(heroes))
+	for _, hero := range heroes {
+		response = append(response, NewHero(hero))
+	}
+	return response
+}
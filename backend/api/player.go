@@ -0,0 +1,26 @@
+package api
+
+import (
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/google/uuid"
+)
+
+// Player is the public representation of a player. It never carries the player secret.
+type Player struct {
+	ID             uuid.UUID  `json:"ID"`
+	UserName       string     `json:"UserName"`
+	UserNameSuffix uint32     `json:"UserNameSuffix"`
+	DeletedAt      *time.Time `json:"DeletedAt"`
+}
+
+// NewPlayer maps a database player to its response representation.
+func NewPlayer(player database.Player) Player {
+	return Player{
+		ID:             player.ID,
+		UserName:       player.UserName,
+		UserNameSuffix: player.UserNameSuffix,
+		DeletedAt:      player.DeletedAt,
+	}
+}
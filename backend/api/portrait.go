@@ -0,0 +1,37 @@
+package api
+
+import (
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/google/uuid"
+)
+
+// Portrait is the public representation of an uploaded hero portrait and its moderation state.
+type Portrait struct {
+	ID         uuid.UUID  `json:"ID"`
+	HeroID     uuid.UUID  `json:"HeroID"`
+	Status     string     `json:"Status" enum:"pending,approved,rejected"`
+	UploadedAt time.Time  `json:"UploadedAt"`
+	ReviewedAt *time.Time `json:"ReviewedAt"`
+}
+
+// NewPortrait maps a database portrait to its response representation.
+func NewPortrait(portrait database.HeroPortrait) Portrait {
+	return Portrait{
+		ID:         portrait.ID,
+		HeroID:     portrait.HeroID,
+		Status:     portrait.Status.String(),
+		UploadedAt: portrait.UploadedAt,
+		ReviewedAt: portrait.ReviewedAt,
+	}
+}
+
+// NewPortraits maps a list of database portraits to their response representation.
+func NewPortraits(portraits []database.HeroPortrait) []Portrait {
+	response := make([]Portrait, 0, len(portraits))
+	for _, portrait := range portraits {
+		response = append(response, NewPortrait(portrait))
+	}
+	return response
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// ContentTypeProblem is the media type of RFC 7807 problem details.
+const ContentTypeProblem = "application/problem+json"
+
+// Code is a stable machine readable error code, clients switch on it instead of matching the detail text.
+type Code string
+
+const (
+	CodeInvalidRequest      Code = "invalid_request"
+	CodeUnauthorized        Code = "unauthorized"
+	CodeForbidden           Code = "forbidden"
+	CodeNotFound            Code = "not_found"
+	CodeMethodNotAllowed    Code = "method_not_allowed"
+	CodeConflict            Code = "conflict"
+	CodeRateLimited         Code = "rate_limited"
+	CodeInternal            Code = "internal"
+	CodeUpstreamUnavailable Code = "upstream_unavailable"
+	CodeUnavailable         Code = "unavailable"
+)
+
+// Problem is an RFC 7807 problem details response, it doubles as the error type of the handlers.
+type Problem struct {
+	Type       string `json:"type" description:"URI identifying the problem type, derived from the code" example:"urn:pixel-protocol:problem:not_found"`
+	Title      string `json:"title" description:"Short summary of the problem type" example:"Not Found"`
+	Status     int    `json:"status" description:"HTTP status code" example:"404"`
+	Detail     string `json:"detail,omitempty" description:"Human readable explanation of this occurrence" example:"Hero not found"`
+	Instance   string `json:"instance,omitempty" description:"Request path of this occurrence" example:"/api/hero/0b6e0c1e-3c0f-4b8e-9a51-3d3c0a4b0c55"`
+	Code       Code   `json:"code" description:"Stable machine readable error code" enum:"invalid_request,unauthorized,forbidden,not_found,method_not_allowed,conflict,rate_limited,internal,upstream_unavailable,unavailable"`
+	RetryAfter int    `json:"retryAfter,omitempty" description:"Seconds to wait before retrying, only set for rate_limited"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return string(p.Code)
+	}
+	return string(p.Code) + ": " + p.Detail
+}
+
+// NewProblem creates a problem with the title of the status code.
+func NewProblem(status int, code Code, detail string) *Problem {
+	return &Problem{
+		Type:   "urn:pixel-protocol:problem:" + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// InvalidRequest reports a malformed request, such as an unparsable ID or body.
+func InvalidRequest(detail string) *Problem {
+	return NewProblem(http.StatusBadRequest, CodeInvalidRequest, detail)
+}
+
+// Unauthorized reports a missing or wrong player secret or admin token.
+func Unauthorized(detail string) *Problem {
+	return NewProblem(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+// Forbidden reports a caller that is known but lacks the permission, such as an admin role.
+func Forbidden(detail string) *Problem {
+	return NewProblem(http.StatusForbidden, CodeForbidden, detail)
+}
+
+// NotFound reports a resource that does not exist or is not visible to the caller.
+func NotFound(detail string) *Problem {
+	return NewProblem(http.StatusNotFound, CodeNotFound, detail)
+}
+
+// MethodNotAllowed reports a method the resource does not support.
+func MethodNotAllowed(detail string) *Problem {
+	return NewProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed, detail)
+}
+
+// Conflict reports a request that clashes with existing state, such as a unique constraint.
+func Conflict(detail string) *Problem {
+	return NewProblem(http.StatusConflict, CodeConflict, detail)
+}
+
+// RateLimited reports a client that has to back off for retryAfter.
+func RateLimited(detail string, retryAfter time.Duration) *Problem {
+	problem := NewProblem(http.StatusTooManyRequests, CodeRateLimited, detail)
+	problem.RetryAfter = int((retryAfter + time.Second - 1) / time.Second)
+	return problem
+}
+
+// Internal reports an unexpected server side failure, the detail never contains the cause.
+func Internal() *Problem {
+	return NewProblem(http.StatusInternalServerError, CodeInternal, "Internal server error")
+}
+
+// UpstreamUnavailable reports a dependency such as the fight judge that could not be reached.
+func UpstreamUnavailable(detail string) *Problem {
+	return NewProblem(http.StatusServiceUnavailable, CodeUpstreamUnavailable, detail)
+}
+
+// Unavailable reports a server that cannot take the request right now, such as during shutdown.
+func Unavailable(detail string) *Problem {
+	return NewProblem(http.StatusServiceUnavailable, CodeUnavailable, detail)
+}
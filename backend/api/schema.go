@@ -0,0 +1,116 @@
+package api
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Schemas returns the OpenAPI component schemas of every response type, generated from the structs themselves.
+func Schemas() map[string]any {
+	schemas := map[string]any{}
+	for _, value := range []any{Player{}, Hero{}, Fight{}, FightResult{}, FightsResponse{}, Portrait{}, Problem{}} {
+		t := reflect.TypeOf(value)
+		schemas[t.Name()] = structSchema(t)
+	}
+	return schemas
+}
+
+var (
+	typeUUID = reflect.TypeOf(uuid.UUID{})
+	typeTime = reflect.TypeOf(time.Time{})
+)
+
+// structSchema builds an object schema from the exported json fields of a struct.
+func structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := typeSchema(field.Type)
+		if value, ok := field.Tag.Lookup("format"); ok {
+			schema["format"] = value
+		}
+		if value, ok := field.Tag.Lookup("description"); ok {
+			schema["description"] = value
+		}
+		if value, ok := field.Tag.Lookup("example"); ok {
+			schema["example"] = tagValue(schema, value)
+		}
+		if value, ok := field.Tag.Lookup("enum"); ok {
+			enum := []any{}
+			for _, item := range strings.Split(value, ",") {
+				enum = append(enum, tagValue(schema, item))
+			}
+			schema["enum"] = enum
+		}
+		properties[name] = schema
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// typeSchema maps a go type to its OpenAPI schema.
+func typeSchema(t reflect.Type) map[string]any {
+	nullable := false
+	if t.Kind() == reflect.Pointer {
+		nullable = true
+		t = t.Elem()
+	}
+	var schema map[string]any
+	switch {
+	case t == typeUUID:
+		schema = map[string]any{"type": "string", "format": "uuid"}
+	case t == typeTime:
+		schema = map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		// references are never marked nullable, OpenAPI 3.0 ignores siblings of $ref
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Slice:
+		schema = map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case t.Kind() == reflect.String:
+		schema = map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		schema = map[string]any{"type": "boolean"}
+	case t.Kind() == reflect.Float32, t.Kind() == reflect.Float64:
+		schema = map[string]any{"type": "number"}
+	case t.Kind() == reflect.Int64, t.Kind() == reflect.Uint64:
+		schema = map[string]any{"type": "integer", "format": "int64"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = map[string]any{"type": "integer"}
+		if t.Kind() != reflect.Uint8 {
+			schema["format"] = "int32"
+		}
+	default:
+		schema = map[string]any{}
+	}
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// tagValue converts a struct tag value to the json type of the schema.
+func tagValue(schema map[string]any, value string) any {
+	value = strings.TrimSpace(value)
+	if schema["type"] == "integer" {
+		if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return number
+		}
+	}
+	return value
+}
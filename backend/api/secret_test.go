@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/google/uuid"
+)
+
+// TestResponsesOmitSecret builds every response from models whose players carry a secret and checks it never reaches the JSON
+func TestResponsesOmitSecret(t *testing.T) {
+	secret := uuid.New()
+	player := database.Player{ID: uuid.New(), UserName: "Brave", UserNameSuffix: 7, Secret: secret}
+	attacker := database.Hero{ID: uuid.New(), Country: "US", Elo: 1000, Title: "Knight", Description: "A knight", PlayerID: player.ID, Player: &player}
+	defender := database.Hero{ID: uuid.New(), Country: "ZA", Elo: 1000, Title: "Mage", Description: "A mage", PlayerID: player.ID, Player: &player}
+	player.Heros = []*database.Hero{&attacker, &defender}
+	fight := database.Fight{ID: uuid.New(), AttackerID: attacker.ID, Attacker: &attacker, DefenderID: defender.ID, Defender: &defender, Timestamp: time.Now(), Outcome: database.FightOutcome(1), Transcript: "The knight wins"}
+	portrait := database.HeroPortrait{ID: uuid.New(), HeroID: attacker.ID, Hero: &attacker, Hash: "hash", UploadedAt: time.Now()}
+
+	tests := []struct {
+		name     string
+		response any
+	}{
+		{"Player", NewPlayer(player)},
+		{"Hero", NewHero(attacker)},
+		{"Heroes", NewHeroes([]database.Hero{attacker, defender})},
+		{"Fight", NewFight(fight)},
+		{"Fights", NewFights([]database.Fight{fight})},
+		{"FightResult", FightResult{Fight: NewFight(fight), Victory: true, EloGain: 16}},
+		{"FightsResponse", FightsResponse{Fights: NewFights([]database.Fight{fight}), HasMore: true, NextCursor: fight.ID.String()}},
+		{"Portrait", NewPortrait(portrait)},
+		{"Portraits", NewPortraits([]database.HeroPortrait{portrait})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := json.Marshal(test.response)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			output := strings.ToLower(string(body))
+			if strings.Contains(output, `"secret"`) {
+				t.Errorf("response has a secret key: %s", body)
+			}
+			for _, value := range []string{secret.String(), strings.ReplaceAll(secret.String(), "-", "")} {
+				if strings.Contains(output, value) {
+					t.Errorf("response has the secret value %s: %s", value, body)
+				}
+			}
+		})
+	}
+}
@@ -7,28 +7,91 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/expki/backend/pixel-protocol/metrics"
+	"github.com/expki/backend/pixel-protocol/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = tracing.Tracer("github.com/expki/backend/pixel-protocol/claude")
+
 type Client struct {
-	apiKey     string
-	model      string
+	settings   atomic.Pointer[settings]
 	httpClient *http.Client
+
+	// last reachability check, cached for pingInterval
+	pingMutex sync.Mutex
+	pingAt    time.Time
+	pingErr   error
+}
+
+// pingInterval bounds how often readiness probes reach the Claude API
+const pingInterval = time.Minute
+
+// settings are swapped as a whole on reload so a request never mixes the key of one config with the model of another
+type settings struct {
+	apiKey string
+	model  string
 }
 
 func NewClient(apiKey, model string) *Client {
+	c := &Client{
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: tracing.Transport(metrics.ClaudeTransport(http.DefaultTransport)),
+		},
+	}
+	c.Configure(apiKey, model)
+	return c
+}
+
+// Configure switches the API key and model for the following requests
+func (c *Client) Configure(apiKey, model string) {
 	if model == "" {
 		model = "claude-sonnet-4-20250514"
 	}
-	return &Client{
-		apiKey: apiKey,
-		model:  model,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+	c.settings.Store(&settings{apiKey: apiKey, model: model})
+	c.pingMutex.Lock()
+	c.pingAt = time.Time{}
+	c.pingMutex.Unlock()
+}
+
+// Ping checks that the Claude API is reachable with the configured key.
+// The result is reused for pingInterval so frequent probes do not spend rate limit.
+func (c *Client) Ping(ctx context.Context) error {
+	c.pingMutex.Lock()
+	defer c.pingMutex.Unlock()
+	if !c.pingAt.IsZero() && time.Since(c.pingAt) < pingInterval {
+		return c.pingErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	settings := c.settings.Load()
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", "https://api.anthropic.com/v1/models?limit=1", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
 	}
+	httpReq.Header.Set("x-api-key", settings.apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		err = fmt.Errorf("failed to send request: %w", err)
+	} else {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("API request failed with status %d", resp.StatusCode)
+		}
+	}
+	c.pingAt, c.pingErr = time.Now(), err
+	return err
 }
 
 type Message struct {
@@ -49,6 +112,18 @@ type Response struct {
 }
 
 func (c *Client) GenerateCombatNarrative(ctx context.Context, attacker, defender database.Hero) (narrative string, outcome database.FightOutcome, err error) {
+	settings := c.settings.Load()
+	ctx, span := tracer.Start(ctx, "claude.GenerateCombatNarrative", trace.WithAttributes(attribute.String("claude.model", settings.model)))
+	defer func() {
+		if err != nil {
+			metrics.ClaudeErrors.Inc()
+			tracing.RecordError(span, err)
+		} else {
+			span.SetAttributes(attribute.String("fight.outcome", outcome.String()))
+		}
+		span.End()
+	}()
+
 	prompt := fmt.Sprintf(`You are a whimsical storyteller for a fantasy combat game where CREATIVITY and IMAGINATION determine victory, not logic or power levels. 
 
 Attacker: %s
@@ -81,7 +156,7 @@ OUTCOME: DRAW
 Let creativity triumph over logic!`, attacker.Title, attacker.Description, attacker.Country, defender.Title, defender.Description, defender.Country)
 
 	req := Request{
-		Model: c.model,
+		Model: settings.model,
 		Messages: []Message{
 			{
 				Role:    "user",
@@ -102,7 +177,7 @@ Let creativity triumph over logic!`, attacker.Title, attacker.Description, attac
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set("x-api-key", settings.apiKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 
 	resp, err := c.httpClient.Do(httpReq)
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/expki/backend/pixel-protocol/config"
+	"github.com/expki/backend/pixel-protocol/database"
+)
+
+// commands are the subcommands next to serve, each returns the process exit code
+var commands = map[string]func(args []string) int{
+	"config":   runConfig,
+	"migrate":  runMigrate,
+	"seed":     runSeed,
+	"export":   runExport,
+	"import":   runImport,
+	"gen-cert": runGenCert,
+	"fight":    runFight,
+	"help":     runHelp,
+	"-h":       runHelp,
+	"--help":   runHelp,
+}
+
+const usage = `usage: pixel-protocol [command] [flags] [config path]
+
+commands:
+  serve     run the servers, the default, creates a sample config if missing
+  config    print or check the effective config
+  migrate   apply the database schema without serving
+  seed      generate fake players, heroes and fights for development
+  export    dump players, heroes and fights as JSONL
+  import    load a JSONL dump written by export
+  gen-cert  write the self-signed certificates the server would generate
+  fight     run one judge call offline for prompt debugging
+
+The config path defaults to config.json, run a command with -h for its flags.`
+
+func runHelp(args []string) int {
+	fmt.Fprintln(os.Stderr, usage)
+	return 0
+}
+
+// newFlags creates the flag set of a command, the usage line lists its arguments after the flags
+func newFlags(name, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pixel-protocol %s [flags] %s\n", name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// commandConfig loads the config named by the first argument left after the flags
+func commandConfig(flags *flag.FlagSet) (config.Config, bool) {
+	configPath := "config.json"
+	if flags.NArg() > 0 {
+		configPath = flags.Arg(0)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Load: %v\n", err)
+		return cfg, false
+	}
+	return cfg, true
+}
+
+// commandDatabase opens the configured database, New applies the schema like serve does
+func commandDatabase(ctx context.Context, cfg config.Config) (*database.Database, bool) {
+	db, err := database.New(ctx, cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "database.New: %v\n", err)
+		return nil, false
+	}
+	return db, true
+}
+
+// runMigrate applies the schema and exits, e.g. before rolling out a new version
+func runMigrate(args []string) int {
+	flags := newFlags("migrate", "[config path]")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	cfg, ok := commandConfig(flags)
+	if !ok {
+		return 1
+	}
+	db, ok := commandDatabase(context.Background(), cfg)
+	if !ok {
+		return 1
+	}
+	defer db.Close()
+
+	// New only logs a failed migration so serving can continue, repeating it surfaces the error
+	err := db.Migrate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migrate: %v\n", err)
+		return 1
+	}
+	fmt.Println("Database schema is up to date")
+	return 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/expki/backend/pixel-protocol/config"
+)
+
+// runGenCert writes the self-signed ECDSA and RSA certificates serve generates when tls.certificates is empty.
+// The names and addresses come from tls.dns and tls.ip, without a config file the host names and addresses are used.
+func runGenCert(args []string) int {
+	flags := newFlags("gen-cert", "[config path]")
+	dir := flags.String("dir", "certs", "directory to write the certificates and keys to")
+	force := flags.Bool("force", false, "overwrite existing files")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var tlsConfig config.ConfigTLS
+	if _, err := os.Stat("config.json"); flags.NArg() > 0 || err == nil {
+		cfg, ok := commandConfig(flags)
+		if !ok {
+			return 1
+		}
+		tlsConfig = cfg.TLS
+	}
+	paths, err := tlsConfig.WriteSelfSigned(*dir, *force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WriteSelfSigned: %v\n", err)
+		return 1
+	}
+
+	snippet, err := json.MarshalIndent(paths, "", "    ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Marshal: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Add the certificates to tls.certificates to serve them:")
+	fmt.Println(string(snippet))
+	return 0
+}
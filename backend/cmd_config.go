@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/expki/backend/pixel-protocol/config"
+)
+
+// runConfig inspects the effective configuration, i.e. the file with the environment overrides applied
+func runConfig(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: pixel-protocol config print|check ...")
+		return 2
+	}
+	switch args[0] {
+	case "print":
+		return runConfigPrint(args[1:])
+	case "check":
+		return runConfigCheck(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config command %q, use print or check\n", args[0])
+		return 2
+	}
+}
+
+// runConfigCheck validates the config without starting the servers, it exits 1 on any problem
+func runConfigCheck(args []string) int {
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: pixel-protocol config check [config path]")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	configPath := "config.json"
+	if flags.NArg() > 0 {
+		configPath = flags.Arg(0)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Load: %v\n", err)
+		return 1
+	}
+	err = cfg.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s is invalid:\n%v\n", configPath, err)
+		return 1
+	}
+	fmt.Printf("%s is valid\n", configPath)
+	return 0
+}
+
+// runConfigPrint writes the effective config, optionally without secrets
+func runConfigPrint(args []string) int {
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: pixel-protocol config print [--redacted] [--format json|yaml] [config path]")
+		flags.PrintDefaults()
+	}
+	redact := flags.Bool("redacted", false, "replace secrets such as API keys and database connections")
+	format := flags.String("format", "", "output format, defaults to the format of the config file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	configPath := "config.json"
+	if flags.NArg() > 0 {
+		configPath = flags.Arg(0)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Load: %v\n", err)
+		return 1
+	}
+	if *redact {
+		cfg = cfg.Redacted()
+	}
+	outputPath := configPath
+	switch *format {
+	case "":
+	case "json", "yaml":
+		outputPath = "config." + *format
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		return 2
+	}
+	raw, err := config.Marshal(cfg, outputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Marshal: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(raw)
+	if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+		fmt.Println()
+	}
+	return 0
+}
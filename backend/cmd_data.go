@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// dumpBatchSize is the number of rows read or written per statement by export, import and seed
+const dumpBatchSize = 500
+
+// dumpRecord is one line of an export, exactly one of the entries is set.
+// Players come first, then heroes and fights, so an import never references a missing row.
+// Players keep their secret so they can still log in after an import, treat a dump like a credential.
+type dumpRecord struct {
+	Player *dumpPlayer `json:"player,omitempty"`
+	Hero   *dumpHero   `json:"hero,omitempty"`
+	Fight  *dumpFight  `json:"fight,omitempty"`
+}
+
+type dumpPlayer struct {
+	ID             uuid.UUID  `json:"id"`
+	UserName       string     `json:"user_name"`
+	UserNameSuffix uint32     `json:"user_name_suffix"`
+	Secret         uuid.UUID  `json:"secret"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+type dumpHero struct {
+	ID          uuid.UUID  `json:"id"`
+	PlayerID    uuid.UUID  `json:"player_id"`
+	Country     string     `json:"country"`
+	Elo         uint32     `json:"elo"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+type dumpFight struct {
+	ID         uuid.UUID             `json:"id"`
+	AttackerID uuid.UUID             `json:"attacker_id"`
+	DefenderID uuid.UUID             `json:"defender_id"`
+	Timestamp  time.Time             `json:"timestamp"`
+	Outcome    database.FightOutcome `json:"outcome"`
+	Transcript string                `json:"transcript"`
+}
+
+// runExport writes every player, hero and fight, including soft deleted ones, as JSONL in primary key order.
+// Images and portraits are not part of the dump.
+func runExport(args []string) int {
+	flags := newFlags("export", "[config path]")
+	output := flags.String("output", "-", "file to write, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	cfg, ok := commandConfig(flags)
+	if !ok {
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Create: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	} else {
+		// the database logs to stdout, it would corrupt the dump
+		cfg.Database.LogLevel = "silent"
+	}
+	db, ok := commandDatabase(context.Background(), cfg)
+	if !ok {
+		return 1
+	}
+	defer db.Close()
+
+	writer := bufio.NewWriter(out)
+	players, heroes, fights, err := exportDump(context.Background(), db, json.NewEncoder(writer))
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d players, %d heroes and %d fights\n", players, heroes, fights)
+	return 0
+}
+
+// exportDump reads every table in one read-only transaction, rows written meanwhile are all in the dump or none are.
+// Postgres needs repeatable read for that, a sqlite transaction always reads a single snapshot.
+func exportDump(ctx context.Context, db *database.Database, encoder *json.Encoder) (players, heroes, fights int, err error) {
+	snapshot := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	err = db.DB.Clauses(dbresolver.Read).WithContext(ctx).Transaction(func(read *gorm.DB) error {
+		var playerBatch []database.Player
+		err := read.FindInBatches(&playerBatch, dumpBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, player := range playerBatch {
+				err := encoder.Encode(dumpRecord{Player: &dumpPlayer{
+					ID:             player.ID,
+					UserName:       player.UserName,
+					UserNameSuffix: player.UserNameSuffix,
+					Secret:         player.Secret,
+					DeletedAt:      player.DeletedAt,
+				}})
+				if err != nil {
+					return err
+				}
+			}
+			players += len(playerBatch)
+			return nil
+		}).Error
+		if err != nil {
+			return errors.Join(errors.New("players"), err)
+		}
+
+		var heroBatch []database.Hero
+		err = read.FindInBatches(&heroBatch, dumpBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, hero := range heroBatch {
+				err := encoder.Encode(dumpRecord{Hero: &dumpHero{
+					ID:          hero.ID,
+					PlayerID:    hero.PlayerID,
+					Country:     hero.Country,
+					Elo:         hero.Elo,
+					Title:       hero.Title,
+					Description: hero.Description,
+					DeletedAt:   hero.DeletedAt,
+				}})
+				if err != nil {
+					return err
+				}
+			}
+			heroes += len(heroBatch)
+			return nil
+		}).Error
+		if err != nil {
+			return errors.Join(errors.New("heroes"), err)
+		}
+
+		var fightBatch []database.Fight
+		err = read.FindInBatches(&fightBatch, dumpBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, fight := range fightBatch {
+				err := encoder.Encode(dumpRecord{Fight: &dumpFight{
+					ID:         fight.ID,
+					AttackerID: fight.AttackerID,
+					DefenderID: fight.DefenderID,
+					Timestamp:  fight.Timestamp,
+					Outcome:    fight.Outcome,
+					Transcript: fight.Transcript,
+				}})
+				if err != nil {
+					return err
+				}
+			}
+			fights += len(fightBatch)
+			return nil
+		}).Error
+		if err != nil {
+			return errors.Join(errors.New("fights"), err)
+		}
+		return nil
+	}, snapshot)
+	return players, heroes, fights, err
+}
+
+// runImport loads a dump in a single transaction, rows whose ID already exists are kept as they are.
+// Any other conflict, such as a username held by a different player, aborts the import.
+func runImport(args []string) int {
+	flags := newFlags("import", "[config path]")
+	input := flags.String("input", "-", "file to read, - for stdin")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	cfg, ok := commandConfig(flags)
+	if !ok {
+		return 1
+	}
+
+	var in io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Open: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+	db, ok := commandDatabase(context.Background(), cfg)
+	if !ok {
+		return 1
+	}
+	defer db.Close()
+
+	var players, heroes, fights int
+	err := db.DB.Clauses(dbresolver.Write).WithContext(context.Background()).Transaction(func(tx *gorm.DB) (err error) {
+		players, heroes, fights, err = importDump(tx, in)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d players, %d heroes and %d fights, rows that already existed were skipped\n", players, heroes, fights)
+	return 0
+}
+
+func importDump(tx *gorm.DB, in io.Reader) (players, heroes, fights int, err error) {
+	var playerBatch []database.Player
+	var heroBatch []database.Hero
+	var fightBatch []database.Fight
+	flush := func() error {
+		// a new statement per model, related rows come from their own records
+		insert := func() *gorm.DB {
+			return tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "id"}}, DoNothing: true}).Omit(clause.Associations)
+		}
+		if len(playerBatch) > 0 {
+			result := insert().Create(&playerBatch)
+			if result.Error != nil {
+				return errors.Join(errors.New("players"), result.Error)
+			}
+			players, playerBatch = players+int(result.RowsAffected), playerBatch[:0]
+		}
+		if len(heroBatch) > 0 {
+			result := insert().Create(&heroBatch)
+			if result.Error != nil {
+				return errors.Join(errors.New("heroes"), result.Error)
+			}
+			heroes, heroBatch = heroes+int(result.RowsAffected), heroBatch[:0]
+		}
+		if len(fightBatch) > 0 {
+			result := insert().Create(&fightBatch)
+			if result.Error != nil {
+				return errors.Join(errors.New("fights"), result.Error)
+			}
+			fights, fightBatch = fights+int(result.RowsAffected), fightBatch[:0]
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(in)
+	for line := 1; ; line++ {
+		var record dumpRecord
+		err = decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return players, heroes, fights, errors.Join(fmt.Errorf("record %d", line), err)
+		}
+		switch {
+		case record.Player != nil:
+			playerBatch = append(playerBatch, database.Player{
+				ID:             record.Player.ID,
+				UserName:       record.Player.UserName,
+				UserNameSuffix: record.Player.UserNameSuffix,
+				Secret:         record.Player.Secret,
+				DeletedAt:      record.Player.DeletedAt,
+			})
+		case record.Hero != nil:
+			heroBatch = append(heroBatch, database.Hero{
+				ID:          record.Hero.ID,
+				PlayerID:    record.Hero.PlayerID,
+				Country:     record.Hero.Country,
+				Elo:         record.Hero.Elo,
+				Title:       record.Hero.Title,
+				Description: record.Hero.Description,
+				DeletedAt:   record.Hero.DeletedAt,
+			})
+		case record.Fight != nil:
+			fightBatch = append(fightBatch, database.Fight{
+				ID:         record.Fight.ID,
+				AttackerID: record.Fight.AttackerID,
+				DefenderID: record.Fight.DefenderID,
+				Timestamp:  record.Fight.Timestamp,
+				Outcome:    record.Fight.Outcome,
+				Transcript: record.Fight.Transcript,
+			})
+		default:
+			return players, heroes, fights, fmt.Errorf("record %d holds no player, hero or fight", line)
+		}
+		if len(playerBatch)+len(heroBatch)+len(fightBatch) >= dumpBatchSize {
+			if err := flush(); err != nil {
+				return players, heroes, fights, err
+			}
+		}
+	}
+	return players, heroes, fights, flush()
+}
+
+// seed vocabulary, the fake heroes only need to be distinct enough to tell apart in the UI
+var (
+	seedNames       = []string{"Pixel", "Glitch", "Byte", "Sprite", "Vector", "Nibble", "Quark", "Cobalt", "Fizz", "Mochi"}
+	seedAdjectives  = []string{"Sleepy", "Furious", "Tiny", "Cosmic", "Soggy", "Gilded", "Invisible", "Polite", "Haunted", "Caffeinated"}
+	seedCreatures   = []string{"Toaster", "Wizard", "Octopus", "Librarian", "Dragon", "Cactus", "Knight", "Teapot", "Golem", "Pigeon"}
+	seedAbilities   = []string{"throws exceptionally passive-aggressive haikus", "summons a marching band of snails", "rewrites gravity every other Tuesday", "bakes bread that remembers the future", "negotiates with thunderstorms", "folds space like a paper crane"}
+	seedCountries   = []string{"US", "ZA", "DE", "JP", "BR", "IN", "FR", "AU", "CA", "NG"}
+	seedTranscripts = []string{"%s and %s traded impossible blows until the arena itself applauded.", "%s out-imagined %s in a duel nobody will ever explain.", "%s met %s and reality briefly filed a complaint."}
+)
+
+// runSeed fills the database with fake players, heroes and fights for development
+func runSeed(args []string) int {
+	flags := newFlags("seed", "[config path]")
+	playerCount := flags.Int("players", 20, "number of players to create")
+	heroesPerPlayer := flags.Int("heroes", 2, "number of heroes per player")
+	fightCount := flags.Int("fights", 100, "number of fights between the new heroes")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *playerCount < 1 || *heroesPerPlayer < 1 || *fightCount < 0 {
+		fmt.Fprintln(os.Stderr, "players and heroes must be at least 1, fights must not be negative")
+		return 2
+	}
+	if *fightCount > 0 && *playerCount**heroesPerPlayer < 2 {
+		fmt.Fprintln(os.Stderr, "fights need at least 2 heroes")
+		return 2
+	}
+	cfg, ok := commandConfig(flags)
+	if !ok {
+		return 1
+	}
+	db, ok := commandDatabase(context.Background(), cfg)
+	if !ok {
+		return 1
+	}
+	defer db.Close()
+
+	err := db.DB.Clauses(dbresolver.Write).WithContext(context.Background()).Transaction(func(tx *gorm.DB) error {
+		return seed(tx, *playerCount, *heroesPerPlayer, *fightCount)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Seed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Seeded %d players, %d heroes and %d fights\n", *playerCount, *playerCount**heroesPerPlayer, *fightCount)
+	return 0
+}
+
+func seed(tx *gorm.DB, playerCount, heroesPerPlayer, fightCount int) error {
+	// continue after the highest suffix of each name so the unique username index holds
+	suffixes := make(map[string]uint32, len(seedNames))
+	for _, name := range seedNames {
+		var suffix uint32
+		err := tx.Model(&database.Player{}).Where("user_name = ?", name).
+			Select("COALESCE(MAX(user_name_suffix), 0)").Scan(&suffix).Error
+		if err != nil {
+			return errors.Join(errors.New("read username suffixes"), err)
+		}
+		suffixes[name] = suffix
+	}
+
+	players := make([]database.Player, 0, playerCount)
+	heroes := make([]database.Hero, 0, playerCount*heroesPerPlayer)
+	for range playerCount {
+		name := seedNames[rand.IntN(len(seedNames))]
+		suffixes[name]++
+		player := database.Player{ID: uuid.New(), UserName: name, UserNameSuffix: suffixes[name], Secret: uuid.New()}
+		players = append(players, player)
+		for range heroesPerPlayer {
+			adjective := seedAdjectives[rand.IntN(len(seedAdjectives))]
+			creature := seedCreatures[rand.IntN(len(seedCreatures))]
+			heroes = append(heroes, database.Hero{
+				ID:          uuid.New(),
+				PlayerID:    player.ID,
+				Country:     seedCountries[rand.IntN(len(seedCountries))],
+				Elo:         800 + uint32(rand.IntN(600)),
+				Title:       "The " + adjective + " " + creature,
+				Description: fmt.Sprintf("A %s %s who %s.", adjective, creature, seedAbilities[rand.IntN(len(seedAbilities))]),
+			})
+		}
+	}
+
+	fights := make([]database.Fight, 0, fightCount)
+	for range fightCount {
+		attacker := heroes[rand.IntN(len(heroes))]
+		defender := heroes[rand.IntN(len(heroes))]
+		for defender.ID == attacker.ID {
+			defender = heroes[rand.IntN(len(heroes))]
+		}
+		fights = append(fights, database.Fight{
+			ID:         uuid.New(),
+			AttackerID: attacker.ID,
+			DefenderID: defender.ID,
+			Timestamp:  time.Now().Add(-time.Duration(rand.Int64N(int64(30 * 24 * time.Hour)))),
+			Outcome:    database.FightOutcome(rand.IntN(3)),
+			Transcript: fmt.Sprintf(seedTranscripts[rand.IntN(len(seedTranscripts))], attacker.Title, defender.Title),
+		})
+	}
+
+	if err := tx.CreateInBatches(&players, dumpBatchSize).Error; err != nil {
+		return errors.Join(errors.New("players"), err)
+	}
+	if err := tx.CreateInBatches(&heroes, dumpBatchSize).Error; err != nil {
+		return errors.Join(errors.New("heroes"), err)
+	}
+	if len(fights) > 0 {
+		if err := tx.CreateInBatches(&fights, dumpBatchSize).Error; err != nil {
+			return errors.Join(errors.New("fights"), err)
+		}
+	}
+	return nil
+}
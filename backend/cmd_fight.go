@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/expki/backend/pixel-protocol/claude"
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/google/uuid"
+	"gorm.io/plugin/dbresolver"
+)
+
+// runFight asks the judge about a single fight and prints the verdict without storing anything or changing Elo.
+// A hero is either the ID of a stored hero or an ad hoc "Title: description" to try prompts against.
+func runFight(args []string) int {
+	flags := newFlags("fight", "--attacker <hero> --defender <hero> [config path]")
+	attackerFlag := flags.String("attacker", "", `attacking hero, an ID or "Title: description"`)
+	defenderFlag := flags.String("defender", "", `defending hero, an ID or "Title: description"`)
+	model := flags.String("model", "", "judge model, defaults to claude.model")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *attackerFlag == "" || *defenderFlag == "" {
+		flags.Usage()
+		return 2
+	}
+	cfg, ok := commandConfig(flags)
+	if !ok {
+		return 1
+	}
+	if *model != "" {
+		cfg.Claude.Model = *model
+	}
+
+	ctx := context.Background()
+	var db *database.Database
+	if _, err := uuid.Parse(*attackerFlag); err == nil {
+		db, ok = commandDatabase(ctx, cfg)
+	} else if _, err := uuid.Parse(*defenderFlag); err == nil {
+		db, ok = commandDatabase(ctx, cfg)
+	}
+	if !ok {
+		return 1
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	attacker, err := fightHero(ctx, db, *attackerFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "attacker: %v\n", err)
+		return 1
+	}
+	defender, err := fightHero(ctx, db, *defenderFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "defender: %v\n", err)
+		return 1
+	}
+
+	claudeClient := claude.NewClient(cfg.Claude.APIKey, cfg.Claude.Model)
+	narrative, outcome, err := claudeClient.GenerateCombatNarrative(ctx, attacker, defender)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "GenerateCombatNarrative: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s vs %s: %s for the attacker\n\n%s\n", attacker.Title, defender.Title, outcome, narrative)
+	return 0
+}
+
+// fightHero loads a stored hero by ID or builds one from "Title: description"
+func fightHero(ctx context.Context, db *database.Database, value string) (database.Hero, error) {
+	if id, err := uuid.Parse(value); err == nil {
+		var hero database.Hero
+		err = db.DB.Clauses(dbresolver.Read).WithContext(ctx).Where("id = ?", id).First(&hero).Error
+		if err != nil {
+			return hero, errors.Join(fmt.Errorf("load hero %s", id), err)
+		}
+		return hero, nil
+	}
+	title, description, found := strings.Cut(value, ":")
+	title, description = strings.TrimSpace(title), strings.TrimSpace(description)
+	if !found || title == "" || description == "" {
+		return database.Hero{}, fmt.Errorf("%q is neither a hero ID nor \"Title: description\"", value)
+	}
+	return database.Hero{ID: uuid.New(), Title: title, Description: description, Country: "unknown", Elo: 1000}, nil
+}
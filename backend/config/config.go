@@ -15,20 +15,85 @@ func ParseConfig(raw []byte) (config Config, err error) {
 }
 
 type Config struct {
-	Server   ConfigServer `json:"server"`
-	TLS      ConfigTLS    `json:"tls"`
-	Database Database     `json:"database"`
-	LogLevel LogLevel     `json:"log_level"`
-	Claude   ConfigClaude `json:"claude"`
+	Server   ConfigServer  `json:"server"`
+	TLS      ConfigTLS     `json:"tls"`
+	Database Database      `json:"database"`
+	LogLevel LogLevel      `json:"log_level"`
+	Claude   ConfigClaude  `json:"claude"`
+	Images   ConfigImages  `json:"images"`
+	Admin    ConfigAdmin   `json:"admin"`
+	Tracing  ConfigTracing `json:"tracing"`
+	CORS     ConfigCORS    `json:"cors"`
 }
 
 type ConfigServer struct {
-	HttpAddress  string `json:"http_address"`
-	HttpsAddress string `json:"https_address"`
-	Http3Address string `json:"http3_address"`
+	HttpAddress     string   `json:"http_address"`
+	HttpsAddress    string   `json:"https_address"`
+	Http3Address    string   `json:"http3_address"`
+	DrainDelay      Duration `json:"drain_delay"`      // keep serving this long after readiness fails so load balancers stop routing, none when unset
+	ShutdownTimeout Duration `json:"shutdown_timeout"` // drain in-flight requests and fights before closing, 30s when unset
+	WatchConfig     bool     `json:"watch_config"`     // reload when the config file changes, SIGHUP always reloads
 }
 
 type ConfigClaude struct {
-	APIKey string `json:"api_key"`
-	Model  string `json:"model"`
+	APIKey     string `json:"api_key" secret:"true"`
+	Model      string `json:"model"`
+	CheckReady bool   `json:"check_ready"` // readiness fails while the Claude API is unreachable
 }
+
+type ConfigAdmin struct {
+	Token    string                 `json:"token" secret:"true"` // bearer token for moderation without client_ca, empty disables it
+	Address  string                 `json:"address"`             // private listener for /metrics and moderation, empty serves them on the public listeners
+	ClientCA string                 `json:"client_ca"`           // PEM bundle signing admin client certificates, serves the admin listener over mutual TLS with pprof, moderation and config
+	Roles    map[string][]AdminRole `json:"roles"`               // roles of a client certificate subject, keyed by the full subject such as "CN=alice,O=ops" or the common name
+}
+
+// AdminRole grants a group of endpoints on the mutual TLS admin listener
+type AdminRole string
+
+const (
+	AdminRoleMetrics   AdminRole = "metrics"   // GET /metrics
+	AdminRoleDebug     AdminRole = "debug"     // /debug/pprof/
+	AdminRoleModerator AdminRole = "moderator" // /admin/portraits
+	AdminRoleConfig    AdminRole = "config"    // GET /config and POST /config/reload
+)
+
+// AdminRoles lists every known role
+var AdminRoles = []AdminRole{AdminRoleMetrics, AdminRoleDebug, AdminRoleModerator, AdminRoleConfig}
+
+type ConfigCORS struct {
+	AllowedOrigins   []string `json:"allowed_origins"`   // exact origins or one * wildcard such as https://*.example.com, a lone * allows any origin
+	AllowedMethods   []string `json:"allowed_methods"`   // methods a preflight may ask for
+	AllowedHeaders   []string `json:"allowed_headers"`   // request headers a preflight may ask for, * allows any
+	ExposedHeaders   []string `json:"exposed_headers"`   // response headers readable by the browser
+	AllowCredentials bool     `json:"allow_credentials"` // allow cookies, never combined with a lone * origin
+	MaxAge           Duration `json:"max_age"`           // how long browsers cache a preflight
+}
+
+type ConfigImages struct {
+	Store ImageStore `json:"store"` // filesystem or database
+	Path  string     `json:"path"`  // root directory of the filesystem store
+}
+
+type ConfigTracing struct {
+	Exporter    TraceExporter `json:"exporter"`     // otlp, stdout or file, empty disables tracing
+	Endpoint    string        `json:"endpoint"`     // OTLP/HTTP collector address, e.g. localhost:4318
+	Insecure    bool          `json:"insecure"`     // send OTLP over plain HTTP
+	Path        string        `json:"path"`         // output file of the file exporter
+	SampleRatio float64       `json:"sample_ratio"` // fraction of new traces to record, 0 records all
+}
+
+type TraceExporter string
+
+const (
+	TraceExporterOTLP   TraceExporter = "otlp"
+	TraceExporterStdout TraceExporter = "stdout"
+	TraceExporterFile   TraceExporter = "file"
+)
+
+type ImageStore string
+
+const (
+	ImageStoreDatabase   ImageStore = "database"
+	ImageStoreFilesystem ImageStore = "filesystem"
+)
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// MutualTLS reports whether the admin listener requires client certificates
+func (c ConfigAdmin) MutualTLS() bool {
+	return c.ClientCA != ""
+}
+
+// ClientCAs loads the bundle that admin client certificates must chain to
+func (c ConfigAdmin) ClientCAs() (*x509.CertPool, error) {
+	bundle, err := os.ReadFile(c.ClientCA)
+	if err != nil {
+		return nil, errors.Join(errors.New("could not read admin client ca"), err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("admin client ca %q holds no PEM certificates", c.ClientCA)
+	}
+	return pool, nil
+}
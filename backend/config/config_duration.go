@@ -0,0 +1,47 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration written as a Go duration string such as "30s" or "1m30s".
+type Duration time.Duration
+
+// UnmarshalJSON accepts a duration string, or a number of seconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errors.Join(errors.New("duration must be a string or a number of seconds"), err)
+	}
+	if raw == "" {
+		*d = 0
+		return nil
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		return errors.Join(fmt.Errorf("invalid duration %q", raw), err)
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// MarshalJSON writes the duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Duration returns the time.Duration, or fallback when unset.
+func (d Duration) Duration(fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return time.Duration(d)
+}
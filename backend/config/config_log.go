@@ -22,6 +22,20 @@ func (l LogLevel) String() string {
 	return string(l)
 }
 
+// Valid reports a known level or alias, empty falls back to error.
+func (l LogLevel) Valid() bool {
+	switch strings.ToLower(strings.TrimSpace(l.String())) {
+	case "", LogLevelDebug.String(), "trace",
+		LogLevelInfo.String(), "information", "notice",
+		LogLevelWarn.String(), "warning", "alert",
+		LogLevelError.String(), "silent",
+		LogLevelFatal.String(), "critical", "emergency",
+		LogLevelPanic.String():
+		return true
+	}
+	return false
+}
+
 func (l LogLevel) Zap() zap.AtomicLevel {
 	switch strings.ToLower(strings.TrimSpace(l.String())) {
 	case LogLevelDebug.String(), "trace":
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -9,28 +10,39 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	"math/big"
 	mrand "math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/expki/backend/pixel-protocol/metrics"
+	"golang.org/x/crypto/acme/autocert"
 )
 
+// certificateWatchInterval is how often the certificate files are checked for changes
+const certificateWatchInterval = 10 * time.Second
+
 type ConfigTLS struct {
-	mutex            *sync.RWMutex    `json:"-"`
-	DomainNameServer []string         `json:"dns"`
-	IP               []string         `json:"ip"`
-	Certificates     []*ConfigTLSPath `json:"certificates"`
+	mutex            *sync.RWMutex     `json:"-"`
+	DomainNameServer []string          `json:"dns"`
+	IP               []string          `json:"ip"`
+	Certificates     []*ConfigTLSPath  `json:"certificates"`
+	CacheDir         string            `json:"cache_dir"` // keeps a local root CA and the certificates it issues across restarts, empty generates self-signed ones on every start
+	ACME             ConfigACME        `json:"acme"`
+	acme             *autocert.Manager `json:"-"`
 }
 
-// Configurate initialize the tls configuration.
-func (t *ConfigTLS) Configurate() error {
+// Configurate initialize the tls configuration, the certificate files are watched until ctx is done.
+func (t *ConfigTLS) Configurate(ctx context.Context) error {
 	if t.mutex == nil {
 		t.mutex = &sync.RWMutex{}
 	}
@@ -38,20 +50,15 @@ func (t *ConfigTLS) Configurate() error {
 	if err != nil {
 		return errors.Join(errors.New("could not load certificates"), err)
 	}
-	go func() {
-		ticker := time.NewTicker(time.Hour)
-		for {
-			<-ticker.C
-			err := t.reloadCertificates()
-			if err != nil {
-				logger.Sugar().Errorf("could not reload certificates: %v", err)
-			}
-		}
-	}()
+	go t.watchCertificates(ctx)
 	err = t.generateMissingCertificates()
 	if err != nil {
 		return errors.Join(errors.New("could not generate missing certificates"), err)
 	}
+	err = t.configureACME()
+	if err != nil {
+		return errors.Join(errors.New("could not configure acme"), err)
+	}
 	return nil
 }
 
@@ -74,8 +81,12 @@ func (t *ConfigTLS) getIP() []net.IP {
 	return list
 }
 
-// GetCertificate returns the first client supported certificate.
+// GetCertificate returns the ACME certificate of a configured domain, otherwise the first client supported certificate.
 func (t *ConfigTLS) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if certificate, handled, err := t.acmeCertificate(clientHello); handled {
+		return certificate, err
+	}
+
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
 
@@ -103,25 +114,85 @@ func (t *ConfigTLS) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certi
 	tlsPath := t.Certificates[0]
 	tlsPath.mutex.RLock()
 	certificate := tlsPath.certificate
-	tlsPath.mutex.Unlock()
+	tlsPath.mutex.RUnlock()
 	return &certificate, nil
 }
 
-// reloadCertificates reloads all certificates.
+// Ready reports an error unless every certificate is loaded and currently valid.
+func (t *ConfigTLS) Ready() error {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if len(t.Certificates) == 0 {
+		return errors.New("no certificates loaded")
+	}
+	now := time.Now()
+	for idx, tlsPath := range t.Certificates {
+		tlsPath.mutex.RLock()
+		leaf := tlsPath.certificate.Leaf
+		tlsPath.mutex.RUnlock()
+		switch {
+		case leaf == nil:
+			return fmt.Errorf("certificate %d is not loaded", idx)
+		case now.Before(leaf.NotBefore):
+			return fmt.Errorf("certificate %d is not valid before %s", idx, leaf.NotBefore.Format(time.RFC3339))
+		case now.After(leaf.NotAfter):
+			return fmt.Errorf("certificate %d expired at %s", idx, leaf.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// reloadCertificates loads all certificates.
 func (t *ConfigTLS) reloadCertificates() error {
 	// reload individual certificates
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
 	for _, tlsPath := range t.Certificates {
-		err := tlsPath.reloadCertificate()
+		_, err := tlsPath.reloadCertificate()
 		if err != nil {
-			return err
+			return errors.Join(fmt.Errorf("certificate %s", tlsPath.CertPath), err)
 		}
 	}
 	return nil
 }
 
-// generateMissingCertificates generates missing certificates.
+// watchCertificates polls the certificate files until ctx is done, so renewed certificates are served without a restart.
+// Generated certificates are issued again before they expire.
+func (t *ConfigTLS) watchCertificates(ctx context.Context) {
+	ticker := time.NewTicker(certificateWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.rotateCertificates()
+		}
+	}
+}
+
+// rotateCertificates reloads the certificates whose files changed and renews generated ones near expiry.
+// Every rotation is logged and counted.
+func (t *ConfigTLS) rotateCertificates() {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for _, tlsPath := range t.Certificates {
+		rotated, err := tlsPath.reloadCertificate()
+		switch {
+		case err != nil:
+			metrics.CertificateRotations.WithLabelValues(metrics.RotationFailure).Inc()
+			logger.Sugar().Errorf("could not rotate certificate %s, keeping the previous one: %v", tlsPath, err)
+		case rotated:
+			metrics.CertificateRotations.WithLabelValues(metrics.RotationSuccess).Inc()
+			tlsPath.mutex.RLock()
+			leaf := tlsPath.certificate.Leaf
+			tlsPath.mutex.RUnlock()
+			logger.Sugar().Infof("Rotated certificate %s for %s, valid until %s", tlsPath, leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
+// generateMissingCertificates generates missing certificates, issued by the local root CA when CacheDir is set.
 func (t *ConfigTLS) generateMissingCertificates() error {
 	var hasRSA, hasECDSA bool = false, false
 	t.mutex.RLock()
@@ -138,24 +209,33 @@ func (t *ConfigTLS) generateMissingCertificates() error {
 	t.mutex.RUnlock()
 	var certificate tls.Certificate
 	var ecdsaErr, rsaErr error
+	generateECDSA, generateRSA := generateCertificateECDSA, generateCertificateRSA
+	if t.CacheDir != "" {
+		generateECDSA = func([]string, []net.IP) (tls.Certificate, error) { return t.cachedCertificate(algorithm_ecdsa) }
+		generateRSA = func([]string, []net.IP) (tls.Certificate, error) { return t.cachedCertificate(algorithm_rsa) }
+	}
 	if !hasECDSA {
-		certificate, ecdsaErr = generateCertificateECDSA(t.getDNS(), t.getIP())
+		issue := func() (tls.Certificate, error) { return generateECDSA(t.getDNS(), t.getIP()) }
+		certificate, ecdsaErr = issue()
 		if ecdsaErr == nil {
 			t.mutex.Lock()
 			t.Certificates = append(t.Certificates, &ConfigTLSPath{
 				algorithm:   algorithm_ecdsa,
 				certificate: certificate,
+				issue:       issue,
 			})
 			t.mutex.Unlock()
 		}
 	}
 	if !hasRSA {
-		certificate, rsaErr = generateCertificateRSA(t.getDNS(), t.getIP())
+		issue := func() (tls.Certificate, error) { return generateRSA(t.getDNS(), t.getIP()) }
+		certificate, rsaErr = issue()
 		if rsaErr == nil {
 			t.mutex.Lock()
 			t.Certificates = append(t.Certificates, &ConfigTLSPath{
 				algorithm:   algorithm_rsa,
 				certificate: certificate,
+				issue:       issue,
 			})
 			t.mutex.Unlock()
 		}
@@ -173,6 +253,67 @@ func (t *ConfigTLS) generateMissingCertificates() error {
 	return nil
 }
 
+// WriteSelfSigned writes the ECDSA and RSA certificates Configurate generates when none are configured as PEM files into dir.
+// The returned paths can be listed under certificates so the server keeps using them across restarts.
+func (t *ConfigTLS) WriteSelfSigned(dir string, overwrite bool) ([]*ConfigTLSPath, error) {
+	generators := []struct {
+		name     string
+		generate func([]string, []net.IP) (tls.Certificate, error)
+	}{
+		{name: "ecdsa", generate: generateCertificateECDSA},
+		{name: "rsa", generate: generateCertificateRSA},
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("could not create directory %q", dir), err)
+	}
+	paths := make([]*ConfigTLSPath, 0, len(generators))
+	for _, generator := range generators {
+		tlsPath := &ConfigTLSPath{
+			CertPath: filepath.Join(dir, generator.name+".crt"),
+			KeyPath:  filepath.Join(dir, generator.name+".key"),
+		}
+		if !overwrite {
+			for _, path := range []string{tlsPath.CertPath, tlsPath.KeyPath} {
+				if _, err := os.Stat(path); err == nil {
+					return nil, fmt.Errorf("%s already exists", path)
+				}
+			}
+		}
+		certificate, err := generator.generate(t.getDNS(), t.getIP())
+		if err != nil {
+			return nil, errors.Join(errors.New(generator.name), err)
+		}
+		err = writeCertificate(certificate, tlsPath.CertPath, tlsPath.KeyPath)
+		if err != nil {
+			return nil, errors.Join(errors.New(generator.name), err)
+		}
+		paths = append(paths, tlsPath)
+	}
+	return paths, nil
+}
+
+// writeCertificate writes the chain and the PKCS #8 private key as PEM, the key is only readable by the owner
+func writeCertificate(certificate tls.Certificate, certPath, keyPath string) error {
+	var chain []byte
+	for _, der := range certificate.Certificate {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	if err != nil {
+		return errors.Join(errors.New("could not marshal private key"), err)
+	}
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600)
+	if err != nil {
+		return errors.Join(errors.New("could not write private key"), err)
+	}
+	err = os.WriteFile(certPath, chain, 0o644)
+	if err != nil {
+		return errors.Join(errors.New("could not write certificate"), err)
+	}
+	return nil
+}
+
 // generateCertificateECDSA generates a new ECDSA certificate.
 func generateCertificateECDSA(dns []string, ip []net.IP) (certificate tls.Certificate, err error) {
 	// gernerate private key
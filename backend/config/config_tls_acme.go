@@ -0,0 +1,114 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/logger"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEDirectoryLetsEncrypt is the production directory used when directory_url is empty
+const ACMEDirectoryLetsEncrypt = acme.LetsEncryptURL
+
+type ConfigACME struct {
+	Domains      []string `json:"domains"`       // host names to obtain certificates for, empty disables ACME
+	Email        string   `json:"email"`         // account contact for expiry notices, optional
+	DirectoryURL string   `json:"directory_url"` // ACME directory, Let's Encrypt when empty, e.g. https://localhost:14000/dir for Pebble
+	DirectoryCA  string   `json:"directory_ca"`  // PEM bundle trusted for the directory on top of the system roots, e.g. the Pebble minica
+	CacheDir     string   `json:"cache_dir"`     // where the account key and certificates are kept across restarts
+	RenewBefore  Duration `json:"renew_before"`  // renew this long before expiry, 30 days when unset
+}
+
+// Enabled reports whether certificates are obtained over ACME
+func (c ConfigACME) Enabled() bool {
+	return len(c.Domains) > 0
+}
+
+// configureACME creates the ACME manager, the first certificate is obtained on the first handshake for a domain
+func (t *ConfigTLS) configureACME() error {
+	if !t.ACME.Enabled() {
+		return nil
+	}
+	client := &acme.Client{DirectoryURL: t.ACME.DirectoryURL}
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = ACMEDirectoryLetsEncrypt
+	}
+	if t.ACME.DirectoryCA != "" {
+		bundle, err := os.ReadFile(t.ACME.DirectoryCA)
+		if err != nil {
+			return errors.Join(errors.New("could not read acme directory ca"), err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(bundle) {
+			return fmt.Errorf("acme directory ca %q holds no PEM certificates", t.ACME.DirectoryCA)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+	cacheDir := t.ACME.CacheDir
+	if cacheDir == "" {
+		cacheDir = "acme"
+	}
+	t.acme = &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       autocert.DirCache(cacheDir),
+		HostPolicy:  autocert.HostWhitelist(t.ACME.Domains...),
+		RenewBefore: t.ACME.RenewBefore.Duration(30 * 24 * time.Hour),
+		Client:      client,
+		Email:       t.ACME.Email,
+	}
+	logger.Sugar().Infof("ACME enabled for %s via %s", strings.Join(t.ACME.Domains, ", "), client.DirectoryURL)
+	return nil
+}
+
+// acmeCertificate answers TLS-ALPN-01 challenges and serves the ACME certificates of the configured domains.
+// handled is false when the handshake is for another name, or when issuance failed and a local certificate should be tried.
+func (t *ConfigTLS) acmeCertificate(clientHello *tls.ClientHelloInfo) (certificate *tls.Certificate, handled bool, err error) {
+	if t.acme == nil || clientHello == nil {
+		return nil, false, nil
+	}
+	// a challenge handshake offers only the acme-tls/1 protocol
+	if len(clientHello.SupportedProtos) == 1 && clientHello.SupportedProtos[0] == acme.ALPNProto {
+		certificate, err = t.acme.GetCertificate(clientHello)
+		return certificate, true, err
+	}
+	serverName := strings.TrimSuffix(clientHello.ServerName, ".")
+	if !slices.ContainsFunc(t.ACME.Domains, func(domain string) bool { return strings.EqualFold(domain, serverName) }) {
+		return nil, false, nil
+	}
+	certificate, err = t.acme.GetCertificate(clientHello)
+	if err != nil {
+		logger.Sugar().Errorf("could not get acme certificate for %s: %v", clientHello.ServerName, err)
+		return nil, false, nil
+	}
+	return certificate, true, nil
+}
+
+// HTTPHandler answers HTTP-01 challenges on the plain HTTP listener and passes every other request to next
+func (t *ConfigTLS) HTTPHandler(next http.Handler) http.Handler {
+	if t.acme == nil {
+		return next
+	}
+	return t.acme.HTTPHandler(next)
+}
+
+// NextProtos adds the TLS-ALPN-01 protocol to protos when ACME is enabled
+func (t *ConfigTLS) NextProtos(protos ...string) []string {
+	if t.acme == nil {
+		return protos
+	}
+	return append(protos, acme.ALPNProto)
+}
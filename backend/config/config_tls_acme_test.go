@@ -0,0 +1,519 @@
+package config
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// acmeStandIn is a Pebble-style ACME directory served over its own TLS root.
+// Like Pebble it validates challenges against fixed addresses instead of resolving the domains,
+// a domain named http-01.* is only offered HTTP-01 and tls-alpn-01.* only TLS-ALPN-01.
+// Request signatures are not verified, the stand-in drives the client through RFC 8555 and checks the challenge answers.
+type acmeStandIn struct {
+	t           *testing.T
+	server      *httptest.Server
+	issuer      tls.Certificate
+	httpAddress string                         // the plain HTTP listener answering HTTP-01
+	tlsAddress  string                         // the TLS listener answering TLS-ALPN-01
+	validity    func(issued int) time.Duration // lifetime of a certificate after issued earlier ones for the domain
+
+	mutex      sync.Mutex
+	nonce      int
+	thumbprint string
+	orders     []*standInOrder
+	issued     map[string]int
+}
+
+type standInOrder struct {
+	domain      string
+	challenge   string
+	token       string
+	authz       string // pending, valid or invalid
+	certificate []byte
+}
+
+func newACMEStandIn(t *testing.T) *acmeStandIn {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("issuer key: %v", err)
+	}
+	issuer, err := signCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Pebble stand-in issuer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}, key, nil)
+	if err != nil {
+		t.Fatalf("issuer: %v", err)
+	}
+	a := &acmeStandIn{
+		t:        t,
+		issuer:   issuer,
+		validity: func(int) time.Duration { return 90 * 24 * time.Hour },
+		issued:   map[string]int{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /dir", a.handleDirectory)
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /new-account", a.handleAccount)
+	mux.HandleFunc("POST /new-order", a.handleNewOrder)
+	mux.HandleFunc("POST /order/{id}", a.handleOrder)
+	mux.HandleFunc("POST /authz/{id}", a.handleAuthorization)
+	mux.HandleFunc("POST /challenge/{id}", a.handleChallenge)
+	mux.HandleFunc("POST /finalize/{id}", a.handleFinalize)
+	mux.HandleFunc("POST /certificate/{id}", a.handleCertificate)
+	a.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mutex.Lock()
+		a.nonce++
+		w.Header().Set("Replay-Nonce", "nonce-"+strconv.Itoa(a.nonce))
+		a.mutex.Unlock()
+		w.Header().Set("Cache-Control", "no-store")
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(a.server.Close)
+	return a
+}
+
+// directoryCA writes the root the directory is served with, as the directory_ca of the config
+func (a *acmeStandIn) directoryCA(dir string) string {
+	path := filepath.Join(dir, "pebble.minica.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		a.t.Fatalf("write directory ca: %v", err)
+	}
+	return path
+}
+
+// issuedCount returns how many certificates were issued for the domain
+func (a *acmeStandIn) issuedCount(domain string) int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.issued[domain]
+}
+
+func (a *acmeStandIn) url(path string) string {
+	return a.server.URL + path
+}
+
+func (a *acmeStandIn) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"newNonce":   a.url("/nonce"),
+		"newAccount": a.url("/new-account"),
+		"newOrder":   a.url("/new-order"),
+		"revokeCert": a.url("/revoke"),
+		"keyChange":  a.url("/key-change"),
+	})
+}
+
+// payload decodes the JWS of a request, the account key is returned when the request carries it
+func (a *acmeStandIn) payload(r *http.Request, payload any) (jwk map[string]string) {
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	var protected struct {
+		JWK map[string]string `json:"jwk"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &jws); err != nil {
+		a.t.Errorf("%s: not a JWS: %v", r.URL.Path, err)
+		return nil
+	}
+	if raw, err := base64.RawURLEncoding.DecodeString(jws.Protected); err == nil {
+		json.Unmarshal(raw, &protected)
+	}
+	if raw, err := base64.RawURLEncoding.DecodeString(jws.Payload); err == nil && len(raw) > 0 && payload != nil {
+		if err := json.Unmarshal(raw, payload); err != nil {
+			a.t.Errorf("%s: payload: %v", r.URL.Path, err)
+		}
+	}
+	return protected.JWK
+}
+
+func (a *acmeStandIn) handleAccount(w http.ResponseWriter, r *http.Request) {
+	jwk := a.payload(r, nil)
+	var canonical string
+	switch jwk["kty"] {
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk["crv"], jwk["x"], jwk["y"])
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk["e"], jwk["n"])
+	default:
+		http.Error(w, "unsupported account key", http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	a.mutex.Lock()
+	a.thumbprint = base64.RawURLEncoding.EncodeToString(sum[:])
+	a.mutex.Unlock()
+	w.Header().Set("Location", a.url("/account/1"))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"status": "valid"})
+}
+
+func (a *acmeStandIn) handleNewOrder(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Identifiers []acme.AuthzID `json:"identifiers"`
+	}
+	a.payload(r, &request)
+	if len(request.Identifiers) != 1 {
+		http.Error(w, "one identifier per order", http.StatusBadRequest)
+		return
+	}
+	domain := request.Identifiers[0].Value
+	challenge, _, _ := strings.Cut(domain, ".")
+	token := make([]byte, 16)
+	rand.Read(token)
+	a.mutex.Lock()
+	a.orders = append(a.orders, &standInOrder{domain: domain, challenge: challenge, token: base64.RawURLEncoding.EncodeToString(token), authz: "pending"})
+	id := len(a.orders) - 1
+	a.mutex.Unlock()
+	w.Header().Set("Location", a.url(fmt.Sprintf("/order/%d", id)))
+	w.WriteHeader(http.StatusCreated)
+	a.writeOrder(w, id)
+}
+
+// order returns the order of the path, nil after answering 404
+func (a *acmeStandIn) order(w http.ResponseWriter, r *http.Request) (int, *standInOrder) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err != nil || id < 0 || id >= len(a.orders) {
+		http.NotFound(w, r)
+		return 0, nil
+	}
+	return id, a.orders[id]
+}
+
+func (a *acmeStandIn) writeOrder(w http.ResponseWriter, id int) {
+	a.mutex.Lock()
+	order := a.orders[id]
+	response := map[string]any{
+		"status":         "pending",
+		"identifiers":    []acme.AuthzID{{Type: "dns", Value: order.domain}},
+		"authorizations": []string{a.url(fmt.Sprintf("/authz/%d", id))},
+		"finalize":       a.url(fmt.Sprintf("/finalize/%d", id)),
+	}
+	switch {
+	case order.certificate != nil:
+		response["status"] = "valid"
+		response["certificate"] = a.url(fmt.Sprintf("/certificate/%d", id))
+	case order.authz == "valid":
+		response["status"] = "ready"
+	case order.authz == "invalid":
+		response["status"] = "invalid"
+	}
+	a.mutex.Unlock()
+	json.NewEncoder(w).Encode(response)
+}
+
+func (a *acmeStandIn) handleOrder(w http.ResponseWriter, r *http.Request) {
+	a.payload(r, nil)
+	if id, order := a.order(w, r); order != nil {
+		a.writeOrder(w, id)
+	}
+}
+
+func (a *acmeStandIn) challenge(id int, order *standInOrder) map[string]any {
+	return map[string]any{
+		"type":   order.challenge,
+		"url":    a.url(fmt.Sprintf("/challenge/%d", id)),
+		"token":  order.token,
+		"status": order.authz,
+	}
+}
+
+// handleAuthorization also answers the deactivation autocert sends for authorizations it no longer needs
+func (a *acmeStandIn) handleAuthorization(w http.ResponseWriter, r *http.Request) {
+	a.payload(r, nil)
+	id, order := a.order(w, r)
+	if order == nil {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":     order.authz,
+		"identifier": acme.AuthzID{Type: "dns", Value: order.domain},
+		"challenges": []map[string]any{a.challenge(id, order)},
+	})
+}
+
+// handleChallenge validates the answer right away, Pebble does so in the background
+func (a *acmeStandIn) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	a.payload(r, nil)
+	id, order := a.order(w, r)
+	if order == nil {
+		return
+	}
+	a.mutex.Lock()
+	keyAuthorization := order.token + "." + a.thumbprint
+	a.mutex.Unlock()
+
+	var err error
+	switch order.challenge {
+	case "http-01":
+		err = a.validateHTTP01(order.domain, order.token, keyAuthorization)
+	case "tls-alpn-01":
+		err = a.validateTLSALPN01(order.domain, keyAuthorization)
+	default:
+		err = fmt.Errorf("unknown challenge %q", order.challenge)
+	}
+	a.mutex.Lock()
+	order.authz = "valid"
+	if err != nil {
+		a.t.Logf("%s validation of %s failed: %v", order.challenge, order.domain, err)
+		order.authz = "invalid"
+	}
+	response := a.challenge(id, order)
+	a.mutex.Unlock()
+	json.NewEncoder(w).Encode(response)
+}
+
+func (a *acmeStandIn) validateHTTP01(domain, token, keyAuthorization string) error {
+	request, err := http.NewRequest(http.MethodGet, "http://"+a.httpAddress+"/.well-known/acme-challenge/"+token, nil)
+	if err != nil {
+		return err
+	}
+	request.Host = domain
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != keyAuthorization {
+		return fmt.Errorf("status %d, body %q", response.StatusCode, body)
+	}
+	return nil
+}
+
+func (a *acmeStandIn) validateTLSALPN01(domain, keyAuthorization string) error {
+	connection, err := tls.Dial("tcp", a.tlsAddress, &tls.Config{
+		ServerName:         domain,
+		NextProtos:         []string{acme.ALPNProto},
+		InsecureSkipVerify: true, // the challenge certificate is self-signed
+	})
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+	state := connection.ConnectionState()
+	if state.NegotiatedProtocol != acme.ALPNProto {
+		return fmt.Errorf("negotiated %q", state.NegotiatedProtocol)
+	}
+	leaf := state.PeerCertificates[0]
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return err
+	}
+	want := sha256.Sum256([]byte(keyAuthorization))
+	for _, extension := range leaf.Extensions {
+		if !extension.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}) {
+			continue
+		}
+		var digest []byte
+		if _, err := asn1.Unmarshal(extension.Value, &digest); err != nil {
+			return err
+		}
+		if !extension.Critical || string(digest) != string(want[:]) {
+			return fmt.Errorf("acmeIdentifier does not match the key authorization")
+		}
+		return nil
+	}
+	return fmt.Errorf("no acmeIdentifier extension")
+}
+
+func (a *acmeStandIn) handleFinalize(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		CSR string `json:"csr"`
+	}
+	a.payload(r, &request)
+	id, order := a.order(w, r)
+	if order == nil {
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(request.CSR)
+	if err != nil {
+		http.Error(w, "csr", http.StatusBadRequest)
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil || csr.CheckSignature() != nil || len(csr.DNSNames) != 1 || csr.DNSNames[0] != order.domain {
+		http.Error(w, "csr", http.StatusBadRequest)
+		return
+	}
+	a.mutex.Lock()
+	if order.authz != "valid" {
+		a.mutex.Unlock()
+		http.Error(w, "order not ready", http.StatusForbidden)
+		return
+	}
+	validity := a.validity(a.issued[order.domain])
+	a.issued[order.domain]++
+	a.mutex.Unlock()
+
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	leaf, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: order.domain},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     csr.DNSNames,
+	}, a.issuer.Leaf, csr.PublicKey, a.issuer.PrivateKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.issuer.Leaf.Raw})...)
+	a.mutex.Lock()
+	order.certificate = chain
+	a.mutex.Unlock()
+	w.Header().Set("Location", a.url(fmt.Sprintf("/order/%d", id)))
+	a.writeOrder(w, id)
+}
+
+func (a *acmeStandIn) handleCertificate(w http.ResponseWriter, r *http.Request) {
+	a.payload(r, nil)
+	if _, order := a.order(w, r); order != nil {
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		a.mutex.Lock()
+		w.Write(order.certificate)
+		a.mutex.Unlock()
+	}
+}
+
+// TestACMEEndToEnd obtains certificates from the stand-in over HTTP-01 and TLS-ALPN-01, the listeners are wired like main does
+func TestACMEEndToEnd(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	standIn := newACMEStandIn(t)
+	// the first certificate of a domain is inside renew_before, autocert has to renew it right away
+	standIn.validity = func(issued int) time.Duration {
+		if issued == 0 {
+			return time.Hour
+		}
+		return 90 * 24 * time.Hour
+	}
+
+	dir := t.TempDir()
+	domains := []string{"http-01.pixel.test", "tls-alpn-01.pixel.test"}
+	cfg := ConfigTLS{
+		DomainNameServer: []string{"localhost"},
+		CacheDir:         filepath.Join(dir, "certs"),
+		ACME: ConfigACME{
+			Domains:      domains,
+			DirectoryURL: standIn.url("/dir"),
+			DirectoryCA:  standIn.directoryCA(dir),
+			CacheDir:     filepath.Join(dir, "acme"),
+			RenewBefore:  Duration(24 * time.Hour),
+		},
+	}
+	v := &validator{}
+	cfg.ACME.validate(v, "tls.acme")
+	if len(v.errs) > 0 {
+		t.Fatalf("config rejected: %v", v.errs)
+	}
+	if err := cfg.Configurate(ctx); err != nil {
+		t.Fatalf("Configurate: %v", err)
+	}
+
+	// :80 answers HTTP-01 in front of the application
+	plain := httptest.NewServer(cfg.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("application"))
+	})))
+	defer plain.Close()
+	// :443 answers TLS-ALPN-01 and serves the certificates
+	secure := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("application"))
+	}))
+	secure.TLS = &tls.Config{GetCertificate: cfg.GetCertificate, NextProtos: cfg.NextProtos("http/1.1")}
+	secure.StartTLS()
+	defer secure.Close()
+	standIn.httpAddress = plain.Listener.Addr().String()
+	standIn.tlsAddress = secure.Listener.Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(standIn.issuer.Leaf)
+	handshake := func(domain string) (*x509.Certificate, error) {
+		connection, err := tls.Dial("tcp", standIn.tlsAddress, &tls.Config{ServerName: domain, RootCAs: roots})
+		if err != nil {
+			return nil, err
+		}
+		defer connection.Close()
+		return connection.ConnectionState().PeerCertificates[0], nil
+	}
+
+	for _, domain := range domains {
+		t.Run(domain, func(t *testing.T) {
+			leaf, err := handshake(domain)
+			if err != nil {
+				t.Fatalf("handshake: %v", err)
+			}
+			if err := leaf.CheckSignatureFrom(standIn.issuer.Leaf); err != nil {
+				t.Errorf("served a certificate of %s: %v", leaf.Issuer, err)
+			}
+
+			// renewal replaces the short lived certificate in the background
+			deadline := time.Now().Add(10 * time.Second)
+			for time.Until(leaf.NotAfter) < 24*time.Hour {
+				if time.Now().After(deadline) {
+					t.Fatalf("not renewed, %d issued, serving one valid until %s", standIn.issuedCount(domain), leaf.NotAfter)
+				}
+				time.Sleep(50 * time.Millisecond)
+				if leaf, err = handshake(domain); err != nil {
+					t.Fatalf("handshake after renewal: %v", err)
+				}
+			}
+			if issued := standIn.issuedCount(domain); issued != 2 {
+				t.Errorf("issued %d certificates, want 2", issued)
+			}
+			if _, err := os.Stat(filepath.Join(cfg.ACME.CacheDir, domain)); err != nil {
+				t.Errorf("certificate not cached: %v", err)
+			}
+		})
+	}
+
+	// other names keep the local certificates and plain HTTP reaches the application
+	leaf, err := handshake("localhost")
+	if err == nil || leaf != nil {
+		t.Errorf("localhost verified against the acme issuer")
+	}
+	response, err := http.Get(plain.URL + "/")
+	if err != nil {
+		t.Fatalf("plain request: %v", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "application" {
+		t.Errorf("plain request answered %q", body)
+	}
+}
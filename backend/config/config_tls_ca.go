@@ -0,0 +1,205 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/logger"
+)
+
+const (
+	localCAValidity   = 10 * 365 * 24 * time.Hour
+	localLeafValidity = 365 * 24 * time.Hour
+	localRenewBefore  = 30 * 24 * time.Hour // a cached certificate closer to expiry is issued again
+)
+
+// cachedCertificate returns the leaf of the algorithm from the cache directory, issued by the local root CA.
+// The leaf is issued again when it is missing, near expiry, not signed by the current root or no longer covers the names.
+func (t *ConfigTLS) cachedCertificate(alg algorithm) (tls.Certificate, error) {
+	root, err := t.localCA()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	name := "ecdsa"
+	if alg == algorithm_rsa {
+		name = "rsa"
+	}
+	certPath, keyPath := filepath.Join(t.CacheDir, name+".crt"), filepath.Join(t.CacheDir, name+".key")
+	dns, ip := t.getDNS(), t.getIP()
+
+	certificate, err := loadCachedCertificate(certPath, keyPath)
+	if err == nil {
+		leaf := certificate.Leaf
+		switch {
+		case time.Until(leaf.NotAfter) < localRenewBefore:
+			logger.Sugar().Infof("Local %s certificate expires at %s, issuing a new one", name, leaf.NotAfter.Format(time.RFC3339))
+		case leaf.CheckSignatureFrom(root.Leaf) != nil:
+			logger.Sugar().Infof("Local %s certificate is not signed by the current root, issuing a new one", name)
+		case !sameNames(leaf, dns, ip):
+			logger.Sugar().Infof("Local %s certificate names changed, issuing a new one", name)
+		default:
+			return certificate, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logger.Sugar().Warnf("Local %s certificate is unusable, issuing a new one: %v", name, err)
+	}
+
+	certificate, err = issueLocalCertificate(root, alg, dns, ip)
+	if err != nil {
+		return certificate, err
+	}
+	err = writeCertificate(certificate, certPath, keyPath)
+	if err != nil {
+		return certificate, err
+	}
+	logger.Sugar().Infof("Issued local %s certificate %s, valid until %s", name, certPath, certificate.Leaf.NotAfter.Format(time.RFC3339))
+	return certificate, nil
+}
+
+// localCA loads the root CA from the cache directory, a missing or expiring root is created.
+// Developers trust ca.crt once to accept every certificate the server issues from it.
+func (t *ConfigTLS) localCA() (tls.Certificate, error) {
+	certPath, keyPath := filepath.Join(t.CacheDir, "ca.crt"), filepath.Join(t.CacheDir, "ca.key")
+	root, err := loadCachedCertificate(certPath, keyPath)
+	if err == nil && time.Until(root.Leaf.NotAfter) >= localRenewBefore {
+		return root, nil
+	}
+	// a damaged root is not replaced silently, developers may already trust it
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return root, errors.Join(errors.New("could not load local root ca"), err)
+	}
+
+	err = os.MkdirAll(t.CacheDir, 0o700)
+	if err != nil {
+		return root, errors.Join(errors.New("could not create certificate cache"), err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return root, errors.Join(errors.New("could not generate root ca key"), err)
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Pixel Protocol local root " + hostname, Organization: []string{"vdh.dev"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(localCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+	}
+	root, err = signCertificate(template, key, nil)
+	if err != nil {
+		return root, errors.Join(errors.New("could not create root ca"), err)
+	}
+	err = writeCertificate(root, certPath, keyPath)
+	if err != nil {
+		return root, errors.Join(errors.New("could not write root ca"), err)
+	}
+	logger.Sugar().Infof("Created local root CA %s, trust it to accept the local certificates", certPath)
+	return root, nil
+}
+
+// issueLocalCertificate issues a server certificate for the names signed by the root
+func issueLocalCertificate(root tls.Certificate, alg algorithm, dns []string, ip []net.IP) (tls.Certificate, error) {
+	var key crypto.Signer
+	var err error
+	keyUsage := x509.KeyUsageDigitalSignature
+	if alg == algorithm_rsa {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	}
+	if err != nil {
+		return tls.Certificate{}, errors.Join(errors.New("could not generate key"), err)
+	}
+	commonName := "localhost"
+	if len(dns) > 0 {
+		commonName = dns[0]
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName, Organization: []string{"vdh.dev"}},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(localLeafValidity),
+		KeyUsage:    keyUsage,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:    dns,
+		IPAddresses: ip,
+	}
+	return signCertificate(template, key, &root)
+}
+
+// signCertificate completes the template for key and signs it with the issuer, a nil issuer self-signs
+func signCertificate(template *x509.Certificate, key crypto.Signer, issuer *tls.Certificate) (certificate tls.Certificate, err error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return certificate, errors.Join(errors.New("could not generate serial number"), err)
+	}
+	pubKeyBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return certificate, errors.Join(errors.New("could not marshal public key"), err)
+	}
+	ski := sha1.Sum(pubKeyBytes)
+	template.SerialNumber = serial
+	template.SubjectKeyId = ski[:]
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.Leaf, issuer.PrivateKey.(crypto.Signer)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		return certificate, errors.Join(errors.New("could not create certificate"), err)
+	}
+	certificate.Certificate = [][]byte{der}
+	certificate.PrivateKey = key
+	certificate.Leaf, err = x509.ParseCertificate(der)
+	if err != nil {
+		return certificate, errors.Join(errors.New("could not parse certificate"), err)
+	}
+	return certificate, nil
+}
+
+// loadCachedCertificate loads a certificate and its key, the error wraps os.ErrNotExist when either file is missing
+func loadCachedCertificate(certPath, keyPath string) (tls.Certificate, error) {
+	for _, path := range []string{certPath, keyPath} {
+		if _, err := os.Stat(path); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return certificate, err
+	}
+	if certificate.Leaf == nil {
+		certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+	}
+	return certificate, err
+}
+
+// sameNames reports whether the certificate covers exactly the names
+func sameNames(leaf *x509.Certificate, dns []string, ip []net.IP) bool {
+	if len(leaf.IPAddresses) != len(ip) || !slices.Equal(slices.Sorted(slices.Values(leaf.DNSNames)), slices.Sorted(slices.Values(dns))) {
+		return false
+	}
+	for _, address := range ip {
+		if !slices.ContainsFunc(leaf.IPAddresses, address.Equal) {
+			return false
+		}
+	}
+	return true
+}
@@ -7,8 +7,11 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"os"
 	"sync"
 	"time"
+
+	"github.com/expki/backend/pixel-protocol/metrics"
 )
 
 type algorithm uint8
@@ -24,39 +27,85 @@ type ConfigTLSPath struct {
 	CertPath string `json:"cert_path"`
 	KeyPath  string `json:"key_path"`
 	// computed
-	algorithm   algorithm       `json:"-"`
-	certificate tls.Certificate `json:"-"`
+	algorithm   algorithm                       `json:"-"`
+	certificate tls.Certificate                 `json:"-"`
+	issue       func() (tls.Certificate, error) `json:"-"` // issues a generated certificate again, nil for files
 	// state
-	mutex sync.RWMutex `json:"-"`
+	certModTime time.Time    `json:"-"` // modification times of the files last loaded or attempted
+	keyModTime  time.Time    `json:"-"`
+	mutex       sync.RWMutex `json:"-"`
 }
 
-// reloadCertificate checks if the certificate is still valid and reloads it if necessary.
-func (t *ConfigTLSPath) reloadCertificate() error {
-	// get certificate expiration date
-	t.mutex.RLock()
-	var notAfter time.Time
-	if t.certificate.Leaf != nil {
-		notAfter = t.certificate.Leaf.NotAfter
-	} else {
-		notAfter = time.Now().UTC()
+// reloadCertificate loads the certificate again when the certificate or key file changed since the last attempt.
+// A pair that fails to load keeps the previous certificate, the next change of either file retries.
+func (t *ConfigTLSPath) reloadCertificate() (rotated bool, err error) {
+	// Generated certificates have no files
+	if t.CertPath == "" || t.KeyPath == "" {
+		return t.renewCertificate()
+	}
+	certInfo, err := os.Stat(t.CertPath)
+	if err != nil {
+		return false, errors.Join(errors.New("could not stat certificate"), err)
+	}
+	keyInfo, err := os.Stat(t.KeyPath)
+	if err != nil {
+		return false, errors.Join(errors.New("could not stat key"), err)
 	}
+	t.mutex.Lock()
+	unchanged := certInfo.ModTime().Equal(t.certModTime) && keyInfo.ModTime().Equal(t.keyModTime)
+	t.certModTime, t.keyModTime = certInfo.ModTime(), keyInfo.ModTime()
+	t.mutex.Unlock()
+	if unchanged {
+		return false, nil
+	}
+	err = t.loadCertificate()
+	return err == nil, err
+}
+
+// renewCertificate issues a generated certificate again once it comes within localRenewBefore of its expiry.
+// A failed attempt keeps the previous certificate and is retried on the next check.
+func (t *ConfigTLSPath) renewCertificate() (renewed bool, err error) {
+	t.mutex.RLock()
+	leaf, issue := t.certificate.Leaf, t.issue
 	t.mutex.RUnlock()
-	// if certificate is still valid, return
-	if notAfter.Before(time.Now().UTC().Add(-30 * 24 * time.Hour)) {
-		return nil
+	if issue == nil || leaf == nil || time.Until(leaf.NotAfter) >= localRenewBefore {
+		return false, nil
+	}
+	certificate, err := issue()
+	if err != nil {
+		return false, errors.Join(errors.New("could not issue certificate"), err)
+	}
+	t.mutex.Lock()
+	t.certificate = certificate
+	t.mutex.Unlock()
+	return true, nil
+}
+
+// String names the certificate in logs, by its file or the algorithm of a generated one
+func (t *ConfigTLSPath) String() string {
+	if t.CertPath != "" {
+		return t.CertPath
+	}
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	switch t.algorithm {
+	case algorithm_rsa:
+		return "generated rsa"
+	case algorithm_ecdsa:
+		return "generated ecdsa"
+	default:
+		return "generated"
 	}
-	// reload certificate
-	return t.loadCertificate()
 }
 
-// loadCertificate loads the certificate from the file system.
+// loadCertificate loads the certificate from the file system and swaps it in once it is usable.
 func (t *ConfigTLSPath) loadCertificate() error {
 	// Generate new
 	if t.CertPath == "" || t.KeyPath == "" {
 		return nil
 	}
 
-	// Load Filesystem
+	// Load Filesystem, the pair only loads when the private key matches the certificate public key
 	cert, err := tls.LoadX509KeyPair(t.CertPath, t.KeyPath)
 	if err != nil {
 		return errors.Join(fmt.Errorf("could not load certificate & key"), err)
@@ -65,9 +114,13 @@ func (t *ConfigTLSPath) loadCertificate() error {
 	if err != nil {
 		return errors.Join(errors.New("could not parse certificate"), err)
 	}
+	if time.Now().After(cert.Leaf.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
 	t.mutex.Lock()
 	t.certificate = cert
 	t.mutex.Unlock()
+	metrics.CertificateExpiry.WithLabelValues(t.CertPath).Set(float64(cert.Leaf.NotAfter.Unix()))
 
 	// Update algorithm
 	t.loadAlgorithm()
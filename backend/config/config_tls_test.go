@@ -0,0 +1,132 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRotateCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	generate := func() tls.Certificate {
+		t.Helper()
+		certificate, err := generateCertificateECDSA([]string{"localhost"}, nil)
+		if err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		return certificate
+	}
+
+	// write moves only the named files of the pair in place, so a rotation can be caught half way.
+	// Every write moves the modification times forward, file systems with coarse timestamps would hide quick rewrites.
+	stamp := time.Now()
+	write := func(certificate tls.Certificate, paths ...string) {
+		t.Helper()
+		err := writeCertificate(certificate, filepath.Join(dir, "pending.crt"), filepath.Join(dir, "pending.key"))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		stamp = stamp.Add(time.Minute)
+		for _, path := range paths {
+			pending := filepath.Join(dir, "pending"+filepath.Ext(path))
+			if err := os.Rename(pending, path); err != nil {
+				t.Fatalf("rename: %v", err)
+			}
+			if err := os.Chtimes(path, stamp, stamp); err != nil {
+				t.Fatalf("chtimes: %v", err)
+			}
+		}
+	}
+	served := func(cfg *ConfigTLS) tls.Certificate {
+		t.Helper()
+		certificate, err := cfg.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetCertificate: %v", err)
+		}
+		return *certificate
+	}
+	rotations := func(result string) float64 {
+		return testutil.ToFloat64(metrics.CertificateRotations.WithLabelValues(result))
+	}
+	expect := func(step string, cfg *ConfigTLS, want tls.Certificate, successes, failures float64) {
+		t.Helper()
+		if leaf := served(cfg).Leaf; leaf == nil || leaf.SerialNumber.Cmp(want.Leaf.SerialNumber) != 0 {
+			t.Errorf("%s: served %v, want serial %v", step, leaf, want.Leaf.SerialNumber)
+		}
+		if got := rotations(metrics.RotationSuccess); got != successes {
+			t.Errorf("%s: %v successful rotations, want %v", step, got, successes)
+		}
+		if got := rotations(metrics.RotationFailure); got != failures {
+			t.Errorf("%s: %v failed rotations, want %v", step, got, failures)
+		}
+	}
+
+	first := generate()
+	write(first, certPath, keyPath)
+	cfg := &ConfigTLS{mutex: &sync.RWMutex{}, Certificates: []*ConfigTLSPath{{CertPath: certPath, KeyPath: keyPath}}}
+	if err := cfg.reloadCertificates(); err != nil {
+		t.Fatalf("reloadCertificates: %v", err)
+	}
+	successes, failures := rotations(metrics.RotationSuccess), rotations(metrics.RotationFailure)
+	expect("initial load", cfg, first, successes, failures)
+
+	// unchanged files are not loaded again
+	cfg.rotateCertificates()
+	expect("unchanged", cfg, first, successes, failures)
+
+	// a rotated pair is served on the next check
+	second := generate()
+	write(second, certPath, keyPath)
+	cfg.rotateCertificates()
+	successes++
+	expect("rotated", cfg, second, successes, failures)
+
+	// half way through a rotation the certificate no longer matches the key, the previous pair keeps being served
+	third := generate()
+	write(third, certPath)
+	cfg.rotateCertificates()
+	failures++
+	expect("mismatched pair", cfg, second, successes, failures)
+
+	// the failed attempt is not retried until a file changes again
+	cfg.rotateCertificates()
+	expect("mismatched pair unchanged", cfg, second, successes, failures)
+
+	// the key arrives and completes the pair
+	write(third, keyPath)
+	cfg.rotateCertificates()
+	successes++
+	expect("completed pair", cfg, third, successes, failures)
+
+	// a missing file fails the check and keeps the certificate
+	if err := os.Remove(keyPath); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	cfg.rotateCertificates()
+	failures++
+	expect("missing key", cfg, third, successes, failures)
+}
+
+func TestWatchCertificatesStops(t *testing.T) {
+	cfg := &ConfigTLS{mutex: &sync.RWMutex{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		cfg.watchCertificates(ctx)
+		close(stopped)
+	}()
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher still running after its context ended")
+	}
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variable of every config field, e.g. PIXEL_CLAUDE_API_KEY for claude.api_key
+const EnvPrefix = "PIXEL"
+
+// fileSuffix marks a key or environment variable whose value is read from the named file, e.g. api_key_file
+const fileSuffix = "_file"
+
+// redacted replaces secret values in Redacted
+const redacted = "REDACTED"
+
+// Load reads the config file, JSON or YAML by extension, and applies the environment overrides.
+// A key ending in _file, in the file or the environment, reads the value of its field from that path so secrets stay out of the config.
+func Load(path string) (config Config, err error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return config, errors.Join(fmt.Errorf("read config %q", path), err)
+	}
+	var tree any
+	if isYAML(path) {
+		err = yaml.Unmarshal(raw, &tree)
+	} else {
+		err = json.Unmarshal(raw, &tree)
+	}
+	if err != nil {
+		return config, errors.Join(fmt.Errorf("parse config %q", path), err)
+	}
+	tree, err = resolveFiles(tree)
+	if err != nil {
+		return config, err
+	}
+
+	// YAML shares the json field names, decoding through JSON keeps the custom unmarshalers
+	normalized, err := json.Marshal(tree)
+	if err != nil {
+		return config, errors.Join(errors.New("normalize config"), err)
+	}
+	config, err = ParseConfig(normalized)
+	if err != nil {
+		return config, err
+	}
+	err = applyEnv(reflect.ValueOf(&config).Elem(), EnvPrefix, os.LookupEnv)
+	if err != nil {
+		return config, errors.Join(errors.New("apply environment"), err)
+	}
+	return config, nil
+}
+
+// isYAML reports a config path that holds YAML instead of JSON
+func isYAML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// resolveFiles replaces every key ending in _file with its field holding the trimmed file content
+func resolveFiles(tree any) (any, error) {
+	switch node := tree.(type) {
+	case map[string]any:
+		for key, value := range node {
+			if field, found := strings.CutSuffix(key, fileSuffix); found {
+				path, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf("config key %q must be a file path", key)
+				}
+				content, err := readSecret(path)
+				if err != nil {
+					return nil, errors.Join(fmt.Errorf("config key %q", key), err)
+				}
+				delete(node, key)
+				node[field] = content
+				continue
+			}
+			resolved, err := resolveFiles(value)
+			if err != nil {
+				return nil, err
+			}
+			node[key] = resolved
+		}
+	case []any:
+		for idx, value := range node {
+			resolved, err := resolveFiles(value)
+			if err != nil {
+				return nil, err
+			}
+			node[idx] = resolved
+		}
+	}
+	return tree, nil
+}
+
+// readSecret reads a secret file without the trailing newline editors and orchestrators add
+func readSecret(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("read secret file %q", path), err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// applyEnv overrides every field that has an environment variable named after its json path.
+// Lists take comma separated values or JSON, other values are parsed as JSON and fall back to a plain string.
+func applyEnv(value reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	var errs []error
+	for idx := 0; idx < value.NumField(); idx++ {
+		field := value.Type().Field(idx)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		env := prefix + "_" + strings.ToUpper(name)
+		if field.Type.Kind() == reflect.Struct {
+			errs = append(errs, applyEnv(value.Field(idx), env, lookup))
+			continue
+		}
+		raw, ok := lookup(env)
+		if !ok {
+			path, found := lookup(env + strings.ToUpper(fileSuffix))
+			if !found {
+				continue
+			}
+			content, err := readSecret(path)
+			if err != nil {
+				errs = append(errs, errors.Join(fmt.Errorf("%s%s", env, strings.ToUpper(fileSuffix)), err))
+				continue
+			}
+			raw = content
+		}
+		err := json.Unmarshal(envJSON(field.Type, raw), value.Field(idx).Addr().Interface())
+		if err != nil {
+			errs = append(errs, errors.Join(fmt.Errorf("%s", env), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// envJSON turns an environment value into the JSON of a field of type t
+func envJSON(t reflect.Type, raw string) []byte {
+	quoted, _ := json.Marshal(raw)
+	switch {
+	case t.Kind() == reflect.String:
+		return quoted
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(raw), "["):
+		list := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		encoded, _ := json.Marshal(list)
+		return encoded
+	case json.Valid([]byte(raw)):
+		return []byte(raw)
+	default:
+		return quoted
+	}
+}
+
+// Redacted returns a copy of the config with every field tagged secret replaced
+func (c Config) Redacted() Config {
+	redact(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+func redact(value reflect.Value) {
+	for idx := 0; idx < value.NumField(); idx++ {
+		field := value.Type().Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+		target := value.Field(idx)
+		if field.Type.Kind() == reflect.Struct {
+			redact(target)
+			continue
+		}
+		if field.Tag.Get("secret") != "true" {
+			continue
+		}
+		switch {
+		case field.Type.Kind() == reflect.String && target.Len() > 0:
+			target.SetString(redacted)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String:
+			// a new slice, the original config shares the backing array
+			list := reflect.MakeSlice(field.Type, target.Len(), target.Len())
+			for item := 0; item < target.Len(); item++ {
+				if target.Index(item).Len() > 0 {
+					list.Index(item).SetString(redacted)
+				}
+			}
+			target.Set(list)
+		}
+	}
+}
+
+// Marshal encodes the config in the format of the path, YAML keeps the json field names
+func Marshal(config Config, path string) ([]byte, error) {
+	raw, err := json.MarshalIndent(config, "", "    ")
+	if err != nil || !isYAML(path) {
+		return raw, err
+	}
+	var tree any
+	err = json.Unmarshal(raw, &tree)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(tree)
+}
@@ -3,12 +3,14 @@
 package config
 
 import (
+	"slices"
+
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 type Database struct {
-	Connection SingleOrSlice[string] `json:"connection"`
+	Connection SingleOrSlice[string] `json:"connection" secret:"true"`
 	LogLevel   LogLevel              `json:"log_level"` // 0: Silent, 1: Error, 2: Warn, 3: Info, 4: Debug
 }
 
@@ -24,6 +26,18 @@ func (c Database) GetDialectors() (readwrite, readonly []gorm.Dialector) {
 	return readwrite, nil
 }
 
+func (c Database) validate(v *validator, field string) {
+	if !slices.ContainsFunc(c.Connection, func(dsn string) bool { return dsn != "" }) {
+		v.add(field+".connection", "needs at least one writable connection")
+	}
+	if len(c.Connection) > 1 {
+		v.add(field+".connection", "sqlite uses a single connection")
+	}
+	if !c.LogLevel.Valid() {
+		v.add(field+".log_level", "unknown level %q", c.LogLevel)
+	}
+}
+
 var sampleDatabase = Database{
 	Connection: []string{":memory:"},
 }
@@ -1,32 +1,74 @@
 package config
 
 import (
-	"encoding/json"
+	"crypto/rand"
 	"errors"
 	"os"
+	"time"
 )
 
-// CreateSample creates a sample configuration file.
+// SampleAPIKey is the placeholder of the sample config, Validate rejects it.
+const SampleAPIKey = "your-claude-api-key-here"
+
+// CreateSample creates a sample configuration file, YAML when the path ends in .yaml or .yml.
 func CreateSample(path string) error {
 	sample := Config{
 		Server: ConfigServer{
-			HttpAddress:  ":80",
-			HttpsAddress: ":443",
-			Http3Address: ":443",
+			HttpAddress:     ":80",
+			HttpsAddress:    ":443",
+			Http3Address:    ":443",
+			DrainDelay:      Duration(5 * time.Second),
+			ShutdownTimeout: Duration(30 * time.Second),
+			WatchConfig:     false,
 		},
 		TLS: ConfigTLS{
 			DomainNameServer: []string{},
 			IP:               []string{},
 			Certificates:     []*ConfigTLSPath{},
+			CacheDir:         "certs",
+			ACME: ConfigACME{
+				Domains:      []string{},
+				Email:        "",
+				DirectoryURL: ACMEDirectoryLetsEncrypt,
+				DirectoryCA:  "",
+				CacheDir:     "acme",
+				RenewBefore:  Duration(30 * 24 * time.Hour),
+			},
 		},
 		Database: sampleDatabase,
 		LogLevel: LogLevelInfo,
 		Claude: ConfigClaude{
-			APIKey: "your-claude-api-key-here",
-			Model:  "claude-3-5-sonnet-20241022",
+			APIKey:     SampleAPIKey,
+			Model:      "claude-3-5-sonnet-20241022",
+			CheckReady: false,
+		},
+		Images: ConfigImages{
+			Store: ImageStoreFilesystem,
+			Path:  "images",
+		},
+		Admin: ConfigAdmin{
+			Token:    rand.Text(), // moderation on the local admin listener works out of the box
+			Address:  "127.0.0.1:9090",
+			ClientCA: "",
+			Roles:    map[string][]AdminRole{},
+		},
+		Tracing: ConfigTracing{
+			Exporter:    "",
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			Path:        "traces.jsonl",
+			SampleRatio: 1,
+		},
+		CORS: ConfigCORS{
+			AllowedOrigins:   []string{"http://localhost:5081"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders:   []string{"Content-Type", "Content-Encoding", "Authorization", "X-Request-ID"},
+			ExposedHeaders:   []string{"Retry-After", "Deprecation", "Sunset", "Link", "X-Request-ID"},
+			AllowCredentials: true,
+			MaxAge:           Duration(10 * time.Minute),
 		},
 	}
-	raw, err := json.MarshalIndent(sample, "", "    ")
+	raw, err := Marshal(sample, path)
 	if err != nil {
 		return errors.Join(errors.New("could not marshal sample config"), err)
 	}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is a problem with a single field, the path uses the config key names, e.g. tls.certificates[0].key_path
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors lists every problem Validate found
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for idx, err := range e {
+		lines[idx] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator collects the problems of a Validate pass
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(field, format string, args ...any) {
+	v.errs = append(v.errs, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// address checks a listen address such as ":443" or "127.0.0.1:9090"
+func (v *validator) address(field, address string, required bool) {
+	if address == "" {
+		if required {
+			v.add(field, "is required")
+		}
+		return
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		v.add(field, "%q is not a host:port address", address)
+		return
+	}
+	if number, err := strconv.ParseUint(port, 10, 16); err != nil {
+		if _, err := net.LookupPort("tcp", port); err != nil {
+			v.add(field, "%q has an invalid port", address)
+		}
+	} else if number == 0 {
+		v.add(field, "%q needs a fixed port", address)
+	}
+}
+
+// file checks that a path points to a readable regular file
+func (v *validator) file(field, path string) {
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		v.add(field, "%v", err)
+	case info.IsDir():
+		v.add(field, "%q is a directory", path)
+	}
+}
+
+// Validate checks the whole config and returns ValidationErrors with every problem, nil when it is usable
+func (c Config) Validate() error {
+	v := &validator{}
+
+	v.address("server.http_address", c.Server.HttpAddress, true)
+	v.address("server.https_address", c.Server.HttpsAddress, true)
+	v.address("server.http3_address", c.Server.Http3Address, true)
+	if c.Server.DrainDelay < 0 {
+		v.add("server.drain_delay", "must not be negative")
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		v.add("server.shutdown_timeout", "must not be negative")
+	}
+
+	for idx, address := range c.TLS.IP {
+		if net.ParseIP(address) == nil {
+			v.add(fmt.Sprintf("tls.ip[%d]", idx), "%q is not an IP address", address)
+		}
+	}
+	for idx, certificate := range c.TLS.Certificates {
+		field := fmt.Sprintf("tls.certificates[%d]", idx)
+		if certificate == nil {
+			v.add(field, "is empty")
+			continue
+		}
+		switch {
+		case certificate.CertPath == "" && certificate.KeyPath == "":
+			v.add(field, "needs cert_path and key_path, leave the certificate out to generate one")
+		case certificate.CertPath == "":
+			v.add(field+".cert_path", "is required with key_path")
+		case certificate.KeyPath == "":
+			v.add(field+".key_path", "is required with cert_path")
+		default:
+			v.file(field+".cert_path", certificate.CertPath)
+			v.file(field+".key_path", certificate.KeyPath)
+		}
+	}
+	c.TLS.ACME.validate(v, "tls.acme")
+
+	c.Database.validate(v, "database")
+	if !c.LogLevel.Valid() {
+		v.add("log_level", "unknown level %q, use debug, info, warn, error, fatal or panic", c.LogLevel)
+	}
+
+	switch strings.TrimSpace(c.Claude.APIKey) {
+	case "":
+		v.add("claude.api_key", "is required, set it or PIXEL_CLAUDE_API_KEY(_FILE)")
+	case SampleAPIKey:
+		v.add("claude.api_key", "still holds the sample placeholder")
+	}
+
+	switch c.Images.Store {
+	case ImageStoreDatabase, "":
+	case ImageStoreFilesystem:
+		if c.Images.Path == "" {
+			v.add("images.path", "is required for the filesystem store")
+		}
+	default:
+		v.add("images.store", "unknown store %q, use %s or %s", c.Images.Store, ImageStoreDatabase, ImageStoreFilesystem)
+	}
+
+	v.address("admin.address", c.Admin.Address, false)
+	if c.Admin.ClientCA != "" {
+		if c.Admin.Address == "" {
+			v.add("admin.address", "is required with client_ca")
+		}
+		v.file("admin.client_ca", c.Admin.ClientCA)
+	}
+	for _, subject := range slices.Sorted(maps.Keys(c.Admin.Roles)) {
+		for _, role := range c.Admin.Roles[subject] {
+			if !slices.Contains(AdminRoles, role) {
+				v.add(fmt.Sprintf("admin.roles[%q]", subject), "unknown role %q, use %s, %s, %s or %s", role, AdminRoleMetrics, AdminRoleDebug, AdminRoleModerator, AdminRoleConfig)
+			}
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case "", TraceExporterStdout:
+	case TraceExporterOTLP:
+		if c.Tracing.Endpoint == "" {
+			v.add("tracing.endpoint", "is required for the otlp exporter")
+		}
+	case TraceExporterFile:
+		if c.Tracing.Path == "" {
+			v.add("tracing.path", "is required for the file exporter")
+		}
+	default:
+		v.add("tracing.exporter", "unknown exporter %q, use %s, %s or %s", c.Tracing.Exporter, TraceExporterOTLP, TraceExporterStdout, TraceExporterFile)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.add("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	c.CORS.validate(v, "cors")
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func (c ConfigCORS) validate(v *validator, field string) {
+	for idx, origin := range c.AllowedOrigins {
+		path := fmt.Sprintf("%s.allowed_origins[%d]", field, idx)
+		if origin == "*" {
+			if c.AllowCredentials {
+				v.add(path, "any origin cannot be combined with allow_credentials")
+			}
+			continue
+		}
+		if strings.Count(origin, "*") > 1 {
+			v.add(path, "%q has more than one wildcard", origin)
+			continue
+		}
+		parsed, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || strings.TrimSuffix(parsed.Path, "/") != "" || parsed.RawQuery != "" {
+			v.add(path, "%q is not an origin such as https://example.com", origin)
+		}
+	}
+	for idx, method := range c.AllowedMethods {
+		if method == "" || strings.ContainsAny(method, " ,") {
+			v.add(fmt.Sprintf("%s.allowed_methods[%d]", field, idx), "%q is not a method", method)
+		}
+	}
+	if c.MaxAge < 0 {
+		v.add(field+".max_age", "must not be negative")
+	}
+}
+
+func (c ConfigACME) validate(v *validator, field string) {
+	for idx, domain := range c.Domains {
+		path := fmt.Sprintf("%s.domains[%d]", field, idx)
+		switch {
+		case strings.Contains(domain, "*"):
+			v.add(path, "%q is a wildcard, which needs a DNS-01 challenge", domain)
+		case net.ParseIP(domain) != nil:
+			v.add(path, "%q is an IP address, use a host name", domain)
+		case domain == "" || strings.ContainsAny(domain, " /:"):
+			v.add(path, "%q is not a host name", domain)
+		}
+	}
+	if c.DirectoryURL != "" {
+		parsed, err := url.Parse(c.DirectoryURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			v.add(field+".directory_url", "%q is not an http(s) URL", c.DirectoryURL)
+		}
+	}
+	if c.DirectoryCA != "" {
+		v.file(field+".directory_ca", c.DirectoryCA)
+	}
+	if c.RenewBefore < 0 {
+		v.add(field+".renew_before", "must not be negative")
+	}
+}
@@ -15,7 +15,8 @@ import (
 )
 
 type Database struct {
-	cfg config.Database
+	cfg   config.Database
+	pools *pools
 	*gorm.DB
 }
 
@@ -44,28 +45,29 @@ func New(appCtx context.Context, cfg config.Database) (db *Database, err error)
 	if err != nil {
 		return nil, errors.Join(errors.New("failed to open database connection"), err)
 	}
+	err = godb.Use(&tracingPlugin{})
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to register database tracing"), err)
+	}
 	if sqldb, err := godb.DB(); err == nil {
 		sqldb.SetConnMaxIdleTime(5 * time.Minute)
 		sqldb.SetConnMaxLifetime(time.Hour)
 		sqldb.SetMaxIdleConns(5)
 		sqldb.SetMaxOpenConns(10)
 	}
-	err = godb.Clauses(dbresolver.Write).AutoMigrate(
-		&Player{},
-		&Hero{},
-		&Fight{},
-	)
+	err = migrate(godb)
 	if err != nil {
 		logger.Sugar().Errorf("failed to migrate database: %v", err)
 	}
 
 	// add resolver connections
+	resolverPools := &pools{}
 	if len(readonly)+len(readwrite) > 1 {
 		logger.Sugar().Debugf("Enabling database resolver for read/write splitting. Sources: %d, Replicas: %d", len(readwrite), len(readonly))
 		err = godb.Use(
 			dbresolver.Register(dbresolver.Config{
-				Sources:           readwrite,
-				Replicas:          readonly,
+				Sources:           resolverPools.wrap("source", readwrite),
+				Replicas:          resolverPools.wrap("replica", readonly),
 				Policy:            dbresolver.StrictRoundRobinPolicy(),
 				TraceResolverMode: true,
 			}).
@@ -78,21 +80,36 @@ func New(appCtx context.Context, cfg config.Database) (db *Database, err error)
 			return nil, err
 		}
 	}
-	db = &Database{cfg: cfg, DB: godb}
+	db = &Database{cfg: cfg, pools: resolverPools, DB: godb}
 
 	return db, nil
 }
 
+// Migrate brings the schema up to date with the models, it is safe to repeat
+func (d *Database) Migrate() error {
+	return migrate(d.DB)
+}
+
+func migrate(godb *gorm.DB) error {
+	return godb.Clauses(dbresolver.Write).AutoMigrate(
+		&Player{},
+		&Hero{},
+		&Fight{},
+		&ImageBlob{},
+		&ImageRef{},
+		&HeroPortrait{},
+	)
+}
+
+// Close closes the primary and every dbresolver connection pool
 func (d *Database) Close() error {
-	db, err := d.DB.DB()
-	if err != nil {
-		logger.Sugar().Errorf("failed to get database connection: %v", err)
-		return err
-	}
-	err = db.Close()
-	if err != nil {
-		logger.Sugar().Errorf("failed to close database connection: %v", err)
-		return err
+	var errs []error
+	for _, pool := range d.Pools() {
+		err := pool.DB.Close()
+		if err != nil {
+			logger.Sugar().Errorf("failed to close database connection %s: %v", pool.Name, err)
+			errs = append(errs, err)
+		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
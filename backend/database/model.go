@@ -44,3 +44,28 @@ func (f Fight) OutcomeAttacker() FightOutcome {
 func (f Fight) OutcomeDefender() FightOutcome {
 	return f.Outcome.Invert()
 }
+
+type ImageBlob struct {
+	Hash        string    `gorm:"primarykey"`
+	ContentType string    `gorm:"not null"`
+	Data        []byte    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+}
+
+type ImageRef struct {
+	Owner     string    `gorm:"primarykey"`
+	OwnerID   uuid.UUID `gorm:"primarykey"`
+	Variant   string    `gorm:"primarykey"`
+	Hash      string    `gorm:"index:idx_image_ref_hash;not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+type HeroPortrait struct {
+	ID         uuid.UUID      `gorm:"primarykey"`
+	HeroID     uuid.UUID      `gorm:"index:idx_hero_portrait_hero;not null"`
+	Hero       *Hero          `gorm:"foreignKey:HeroID"`
+	Hash       string         `gorm:"not null"`
+	Status     PortraitStatus `gorm:"index:idx_hero_portrait_status;not null"`
+	UploadedAt time.Time      `gorm:"not null"`
+	ReviewedAt *time.Time
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Pool is a connection pool of the primary or of a dbresolver source or replica
+type Pool struct {
+	Name string
+	DB   *sql.DB
+}
+
+// pools collects the connection pools dbresolver opens from its dialectors
+type pools struct {
+	mutex sync.Mutex
+	list  []Pool
+}
+
+func (p *pools) add(name string, db *sql.DB) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.list = append(p.list, Pool{Name: name, DB: db})
+}
+
+// wrap records the pool of each dialector once dbresolver initializes it
+func (p *pools) wrap(kind string, dialectors []gorm.Dialector) []gorm.Dialector {
+	wrapped := make([]gorm.Dialector, len(dialectors))
+	for idx, dialector := range dialectors {
+		wrapped[idx] = &poolDialector{Dialector: dialector, name: fmt.Sprintf("%s-%d", kind, idx), pools: p}
+	}
+	return wrapped
+}
+
+type poolDialector struct {
+	gorm.Dialector
+	name  string
+	pools *pools
+}
+
+func (d *poolDialector) Initialize(db *gorm.DB) error {
+	err := d.Dialector.Initialize(db)
+	if err != nil {
+		return err
+	}
+	if sqldb, ok := db.ConnPool.(*sql.DB); ok {
+		d.pools.add(d.name, sqldb)
+	}
+	return nil
+}
+
+// Apply forwards the gorm config defaults of the wrapped dialector, e.g. the postgres identifier length
+func (d *poolDialector) Apply(config *gorm.Config) error {
+	if applier, ok := d.Dialector.(interface{ Apply(*gorm.Config) error }); ok {
+		return applier.Apply(config)
+	}
+	return nil
+}
+
+// Pools returns the primary and every dbresolver source and replica
+func (d *Database) Pools() []Pool {
+	d.pools.mutex.Lock()
+	defer d.pools.mutex.Unlock()
+	list := make([]Pool, 0, len(d.pools.list)+1)
+	if sqldb, err := d.DB.DB(); err == nil {
+		list = append(list, Pool{Name: "primary", DB: sqldb})
+	}
+	return append(list, d.pools.list...)
+}
+
+// Ping checks that every connection pool reaches its database
+func (d *Database) Ping(ctx context.Context) error {
+	var errs []error
+	for _, pool := range d.Pools() {
+		err := pool.DB.PingContext(ctx)
+		if err != nil {
+			errs = append(errs, errors.Join(fmt.Errorf("database %s unreachable", pool.Name), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "pixel-protocol:span"
+
+// tracingPlugin creates a client span per statement in the trace of the statement context
+type tracingPlugin struct {
+	tracer trace.Tracer
+}
+
+func (p *tracingPlugin) Name() string {
+	return "pixel-protocol:tracing"
+}
+
+func (p *tracingPlugin) Initialize(db *gorm.DB) error {
+	p.tracer = otel.Tracer("github.com/expki/backend/pixel-protocol/database")
+	callback := db.Callback()
+	return errors.Join(
+		callback.Create().Before("gorm:create").Register("tracing:before_create", p.before("gorm.create")),
+		callback.Create().After("gorm:create").Register("tracing:after_create", p.after),
+		callback.Query().Before("gorm:query").Register("tracing:before_query", p.before("gorm.query")),
+		callback.Query().After("gorm:query").Register("tracing:after_query", p.after),
+		callback.Update().Before("gorm:update").Register("tracing:before_update", p.before("gorm.update")),
+		callback.Update().After("gorm:update").Register("tracing:after_update", p.after),
+		callback.Delete().Before("gorm:delete").Register("tracing:before_delete", p.before("gorm.delete")),
+		callback.Delete().After("gorm:delete").Register("tracing:after_delete", p.after),
+		callback.Row().Before("gorm:row").Register("tracing:before_row", p.before("gorm.row")),
+		callback.Row().After("gorm:row").Register("tracing:after_row", p.after),
+		callback.Raw().Before("gorm:raw").Register("tracing:before_raw", p.before("gorm.raw")),
+		callback.Raw().After("gorm:raw").Register("tracing:after_raw", p.after),
+	)
+}
+
+func (p *tracingPlugin) before(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Statement.Context == nil {
+			return
+		}
+		_, span := p.tracer.Start(tx.Statement.Context, operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system.name", tx.Dialector.Name())),
+		)
+		tx.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func (p *tracingPlugin) after(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+	attributes := []attribute.KeyValue{
+		attribute.String("db.query.text", tx.Statement.SQL.String()),
+		attribute.Int64("db.response.returned_rows", tx.Statement.RowsAffected),
+	}
+	if tx.Statement.Table != "" {
+		attributes = append(attributes, attribute.String("db.collection.name", tx.Statement.Table))
+	}
+	span.SetAttributes(attributes...)
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+}
@@ -8,6 +8,19 @@ const (
 	FightOutcome_Defeat
 )
 
+func (value FightOutcome) String() string {
+	switch value {
+	case FightOutcome_Draw:
+		return "draw"
+	case FightOutcome_Victory:
+		return "victory"
+	case FightOutcome_Defeat:
+		return "defeat"
+	default:
+		return "unknown"
+	}
+}
+
 func (value FightOutcome) Invert() FightOutcome {
 	switch value {
 	case FightOutcome_Defeat:
@@ -18,3 +31,24 @@ func (value FightOutcome) Invert() FightOutcome {
 		return value
 	}
 }
+
+type PortraitStatus uint8
+
+const (
+	PortraitStatus_Pending PortraitStatus = iota
+	PortraitStatus_Approved
+	PortraitStatus_Rejected
+)
+
+func (value PortraitStatus) String() string {
+	switch value {
+	case PortraitStatus_Pending:
+		return "pending"
+	case PortraitStatus_Approved:
+		return "approved"
+	case PortraitStatus_Rejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
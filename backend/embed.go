@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"embed"
-	"io"
+	"encoding/base64"
 	"io/fs"
 	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
 
+	"github.com/andybalholm/brotli"
+	"github.com/expki/backend/pixel-protocol/middleware"
+	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/zstd"
-	"github.com/spf13/afero"
 )
 
 //go:embed dist/*
@@ -21,47 +29,102 @@ var dist = func() fs.FS {
 	return dist
 }()
 
-var distZstd = func() fs.FS {
-	memfs := afero.NewMemMapFs()
-	encoder, err := zstd.NewWriter(nil,
-		zstd.WithEncoderLevel(zstd.SpeedDefault),
+// staticAsset is an embedded file with every representation prepared at startup
+type staticAsset struct {
+	contentType string
+	// body and strong ETag per content coding, "" is identity
+	content map[string][]byte
+	etag    map[string]string
+}
+
+// staticAssets maps the slash separated path of every embedded file to its representations.
+// A coding is left out when the file is too small, already compressed or does not shrink.
+var staticAssets = func() map[string]*staticAsset {
+	zstdEncoder, err := zstd.NewWriter(nil,
+		zstd.WithEncoderLevel(zstd.SpeedBestCompression),
 		zstd.WithEncoderCRC(false),
 		zstd.WithEncoderConcurrency(1),
 	)
 	if err != nil {
 		log.Fatalf("initialize embedding compression: %v", err)
 	}
-	err = fs.WalkDir(dist, ".", func(path string, d fs.DirEntry, err error) error {
+	encoders := map[string]func(content []byte) ([]byte, error){
+		middleware.EncodingZstd: func(content []byte) ([]byte, error) {
+			return zstdEncoder.EncodeAll(content, nil), nil
+		},
+		middleware.EncodingBrotli: func(content []byte) ([]byte, error) {
+			var buffer bytes.Buffer
+			encoder := brotli.NewWriterLevel(&buffer, brotli.BestCompression)
+			if _, err := encoder.Write(content); err != nil {
+				return nil, err
+			}
+			err := encoder.Close()
+			return buffer.Bytes(), err
+		},
+		middleware.EncodingGzip: func(content []byte) ([]byte, error) {
+			var buffer bytes.Buffer
+			encoder, err := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := encoder.Write(content); err != nil {
+				return nil, err
+			}
+			err = encoder.Close()
+			return buffer.Bytes(), err
+		},
+	}
+	assets := map[string]*staticAsset{}
+	err = fs.WalkDir(dist, ".", func(name string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
-		file, err := dist.Open(path)
+		content, err := fs.ReadFile(dist, name)
 		if err != nil {
 			return err
 		}
-		defer file.Close()
-		info, err := file.Stat()
-		if err != nil {
-			return err
+
+		// type by the original name, the encoded bytes would sniff as binary
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(content)
 		}
-		content, err := io.ReadAll(file)
-		if err != nil {
-			return err
+		sum := sha256.Sum256(content)
+		hash := base64.RawURLEncoding.EncodeToString(sum[:18])
+		asset := &staticAsset{
+			contentType: contentType,
+			content:     map[string][]byte{"": content},
+			etag:        map[string]string{"": `"` + hash + `"`},
+		}
+		assets[name] = asset
+		if len(content) < middleware.CompressMinSize || staticIncompressible(name) {
+			return nil
+		}
+		for coding, encode := range encoders {
+			encoded, err := encode(content)
+			if err != nil {
+				return err
+			}
+			if len(encoded) >= len(content) {
+				continue
+			}
+			// every representation needs its own strong validator
+			asset.content[coding] = encoded
+			asset.etag[coding] = `"` + hash + "-" + coding + `"`
 		}
-		var contentZstd []byte
-		contentZstd = encoder.EncodeAll(content, contentZstd)
-		return afero.WriteFile(memfs, path, contentZstd, info.Mode().Perm())
+		return nil
 	})
 	if err != nil {
 		log.Fatalf("read embedding dist: %v", err)
 	}
-	return &compressedFS{Fs: memfs}
+	return assets
 }()
 
-type compressedFS struct {
-	afero.Fs
-}
-
-func (c *compressedFS) Open(name string) (fs.File, error) {
-	return c.Fs.Open(name)
+// staticIncompressible reports assets whose format is already compressed
+func staticIncompressible(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".ico", ".woff", ".woff2", ".mp3", ".mp4", ".webm", ".zip", ".gz", ".br", ".zst":
+		return true
+	}
+	return false
 }
@@ -14,15 +14,20 @@ import (
 //go:embed GeoLite2-Country.mmdb
 var database []byte
 
+// GeoIP is nil when the embedded database could not be opened, every client is then reported as unknown
 var GeoIP *geoip2.Reader = func() *geoip2.Reader {
 	geoip, err := geoip2.FromBytes(database)
 	if err != nil {
-		log.Fatalf("open geoip database: %v", err)
+		log.Printf("open geoip database, countries are reported as unknown: %v", err)
+		return nil
 	}
 	return geoip
 }()
 
 func GetClientCountry(r *http.Request) string {
+	if GeoIP == nil {
+		return "unknown"
+	}
 	country, err := GeoIP.Country(GetClientIP(r))
 	if err != nil || country == nil {
 		return "unknown"
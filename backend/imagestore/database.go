@@ -0,0 +1,180 @@
+package imagestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Database stores image blobs and references as database rows.
+type Database struct {
+	db *database.Database
+}
+
+// NewDatabase creates a store backed by the image tables of the database.
+func NewDatabase(db *database.Database) *Database {
+	return &Database{db: db}
+}
+
+func (d *Database) Put(ctx context.Context, key Key, contentType string, data []byte) (Image, error) {
+	now := time.Now()
+	blob := database.ImageBlob{
+		Hash:        Hash(data),
+		ContentType: contentType,
+		Data:        data,
+		CreatedAt:   now,
+	}
+	ref := database.ImageRef{
+		Owner:     string(key.Owner),
+		OwnerID:   key.ID,
+		Variant:   key.Variant,
+		Hash:      blob.Hash,
+		UpdatedAt: now,
+	}
+	err := d.db.DB.Clauses(dbresolver.Write).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&blob).Error
+		if err != nil {
+			return errors.Join(errors.New("could not store image blob"), err)
+		}
+		return relink(tx, ref)
+	})
+	if err != nil {
+		return Image{}, err
+	}
+	return Image{Hash: blob.Hash, ContentType: contentType, Size: int64(len(data)), ModTime: now}, nil
+}
+
+func (d *Database) Link(ctx context.Context, key Key, image Image) error {
+	ref := database.ImageRef{
+		Owner:     string(key.Owner),
+		OwnerID:   key.ID,
+		Variant:   key.Variant,
+		Hash:      image.Hash,
+		UpdatedAt: time.Now(),
+	}
+	return d.db.DB.Clauses(dbresolver.Write).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return relink(tx, ref)
+	})
+}
+
+// relink points the reference at its hash and collects the blob it linked to before
+func relink(tx *gorm.DB, ref database.ImageRef) error {
+	var previous []string
+	err := tx.Model(&database.ImageRef{}).
+		Where("owner = ? AND owner_id = ? AND variant = ?", ref.Owner, ref.OwnerID, ref.Variant).
+		Pluck("hash", &previous).Error
+	if err != nil {
+		return errors.Join(errors.New("could not read image reference"), err)
+	}
+	err = tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&ref).Error
+	if err != nil {
+		return errors.Join(errors.New("could not store image reference"), err)
+	}
+	for _, hash := range previous {
+		if hash != ref.Hash {
+			err = collect(tx, hash)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// collect removes the blob once no reference links to it
+func collect(tx *gorm.DB, hash string) error {
+	err := tx.Where("hash = ? AND NOT EXISTS (SELECT 1 FROM image_refs WHERE image_refs.hash = image_blobs.hash)", hash).
+		Delete(&database.ImageBlob{}).Error
+	if err != nil {
+		return errors.Join(errors.New("could not remove unreferenced image blob"), err)
+	}
+	return nil
+}
+
+func (d *Database) Lookup(ctx context.Context, key Key) (Image, error) {
+	var image struct {
+		Hash        string
+		ContentType string
+		Size        int64
+		CreatedAt   time.Time
+	}
+	result := d.db.DB.Clauses(dbresolver.Read).WithContext(ctx).
+		Model(&database.ImageRef{}).
+		Select("image_blobs.hash, image_blobs.content_type, LENGTH(image_blobs.data) AS size, image_blobs.created_at").
+		Joins("JOIN image_blobs ON image_blobs.hash = image_refs.hash").
+		Where("image_refs.owner = ? AND image_refs.owner_id = ? AND image_refs.variant = ?", string(key.Owner), key.ID, key.Variant).
+		Limit(1).
+		Scan(&image)
+	if result.Error != nil {
+		return Image{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Image{}, ErrNotFound
+	}
+	return Image{Hash: image.Hash, ContentType: image.ContentType, Size: image.Size, ModTime: image.CreatedAt}, nil
+}
+
+func (d *Database) Open(ctx context.Context, hash string) (Content, Image, error) {
+	var blob database.ImageBlob
+	err := d.db.DB.Clauses(dbresolver.Read).WithContext(ctx).
+		Where("hash = ?", hash).
+		First(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, Image{}, ErrNotFound
+	} else if err != nil {
+		return nil, Image{}, err
+	}
+	image := Image{Hash: blob.Hash, ContentType: blob.ContentType, Size: int64(len(blob.Data)), ModTime: blob.CreatedAt}
+	return nopCloser{bytes.NewReader(blob.Data)}, image, nil
+}
+
+func (d *Database) Variants(ctx context.Context, owner Owner, id uuid.UUID) ([]string, error) {
+	var variants []string
+	err := d.db.DB.Clauses(dbresolver.Read).WithContext(ctx).
+		Model(&database.ImageRef{}).
+		Where("owner = ? AND owner_id = ?", string(owner), id).
+		Pluck("variant", &variants).Error
+	if err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+func (d *Database) Delete(ctx context.Context, key Key) error {
+	return d.db.DB.Clauses(dbresolver.Write).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var hashes []string
+		err := tx.Model(&database.ImageRef{}).
+			Where("owner = ? AND owner_id = ? AND variant = ?", string(key.Owner), key.ID, key.Variant).
+			Pluck("hash", &hashes).Error
+		if err != nil {
+			return errors.Join(errors.New("could not read image reference"), err)
+		}
+		err = tx.Where("owner = ? AND owner_id = ? AND variant = ?", string(key.Owner), key.ID, key.Variant).
+			Delete(&database.ImageRef{}).Error
+		if err != nil {
+			return errors.Join(errors.New("could not remove image reference"), err)
+		}
+		for _, hash := range hashes {
+			err = collect(tx, hash)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build sqlite
+
+package imagestore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/expki/backend/pixel-protocol/config"
+	"github.com/expki/backend/pixel-protocol/database"
+)
+
+func TestDatabaseCollectsReplacedBlobs(t *testing.T) {
+	db, err := database.New(context.Background(), config.Database{
+		Connection: []string{filepath.Join(t.TempDir(), "images.db")},
+		LogLevel:   "silent",
+	})
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	defer db.Close()
+	testCollectsReplacedBlobs(t, NewDatabase(db))
+}
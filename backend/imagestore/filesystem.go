@@ -0,0 +1,259 @@
+package imagestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/google/uuid"
+)
+
+// Filesystem stores image blobs and references as files below a root directory.
+//
+//	<root>/blobs/<hash[:2]>/<hash>
+//	<root>/refs/<owner>/<id>/<variant>.json
+type Filesystem struct {
+	root  string
+	mutex sync.RWMutex
+}
+
+type filesystemRef struct {
+	Hash        string `json:"hash"`
+	ContentType string `json:"content_type"`
+}
+
+// NewFilesystem creates a filesystem store rooted at the given directory.
+func NewFilesystem(root string) (*Filesystem, error) {
+	if root == "" {
+		return nil, errors.New("filesystem image store requires a path")
+	}
+	for _, dir := range []string{"blobs", "refs"} {
+		err := os.MkdirAll(filepath.Join(root, dir), 0o750)
+		if err != nil {
+			return nil, errors.Join(errors.New("could not create image store directory"), err)
+		}
+	}
+	return &Filesystem{root: root}, nil
+}
+
+func (f *Filesystem) blobPath(hash string) string {
+	return filepath.Join(f.root, "blobs", hash[:2], hash)
+}
+
+func (f *Filesystem) refPath(key Key) string {
+	variant := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(key.Variant)
+	return filepath.Join(f.root, "refs", string(key.Owner), key.ID.String(), variant+".json")
+}
+
+func (f *Filesystem) Put(ctx context.Context, key Key, contentType string, data []byte) (Image, error) {
+	hash := Hash(data)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// write blob once, content addressed files never change
+	blob := f.blobPath(hash)
+	if _, err := os.Stat(blob); errors.Is(err, fs.ErrNotExist) {
+		err = writeFileAtomic(blob, data)
+		if err != nil {
+			return Image{}, errors.Join(errors.New("could not write image blob"), err)
+		}
+	}
+
+	// link key to blob
+	previous, _ := f.readRef(key)
+	err := f.writeRef(key, hash, contentType)
+	if err != nil {
+		return Image{}, err
+	}
+	if previous.Hash != "" && previous.Hash != hash {
+		f.collect(previous.Hash)
+	}
+
+	info, err := os.Stat(blob)
+	if err != nil {
+		return Image{}, err
+	}
+	return Image{Hash: hash, ContentType: contentType, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (f *Filesystem) Link(ctx context.Context, key Key, image Image) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, err := os.Stat(f.blobPath(image.Hash)); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	previous, _ := f.readRef(key)
+	err := f.writeRef(key, image.Hash, image.ContentType)
+	if err != nil {
+		return err
+	}
+	if previous.Hash != "" && previous.Hash != image.Hash {
+		f.collect(previous.Hash)
+	}
+	return nil
+}
+
+// readRef returns the blob the key links to, the caller must hold a lock.
+func (f *Filesystem) readRef(key Key) (filesystemRef, error) {
+	raw, err := os.ReadFile(f.refPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return filesystemRef{}, ErrNotFound
+	} else if err != nil {
+		return filesystemRef{}, err
+	}
+	var ref filesystemRef
+	err = json.Unmarshal(raw, &ref)
+	if err != nil || len(ref.Hash) < 2 {
+		return filesystemRef{}, errors.Join(errors.New("corrupt image reference"), err)
+	}
+	return ref, nil
+}
+
+// writeRef links the key to the blob, the caller must hold the write lock.
+func (f *Filesystem) writeRef(key Key, hash, contentType string) error {
+	raw, err := json.Marshal(filesystemRef{Hash: hash, ContentType: contentType})
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(f.refPath(key), raw)
+	if err != nil {
+		return errors.Join(errors.New("could not write image reference"), err)
+	}
+	return nil
+}
+
+func (f *Filesystem) Lookup(ctx context.Context, key Key) (Image, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	ref, err := f.readRef(key)
+	if err != nil {
+		return Image{}, err
+	}
+	info, err := os.Stat(f.blobPath(ref.Hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Image{}, ErrNotFound
+	} else if err != nil {
+		return Image{}, err
+	}
+	return Image{Hash: ref.Hash, ContentType: ref.ContentType, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (f *Filesystem) Open(ctx context.Context, hash string) (Content, Image, error) {
+	if len(hash) < 2 || strings.ContainsAny(hash, `/\.`) {
+		return nil, Image{}, ErrNotFound
+	}
+	file, err := os.Open(f.blobPath(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Image{}, ErrNotFound
+	} else if err != nil {
+		return nil, Image{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Image{}, err
+	}
+
+	// blobs are shared between references, so the content type is sniffed from the content
+	sniff := make([]byte, 512)
+	n, _ := io.ReadFull(file, sniff)
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, Image{}, err
+	}
+	contentType := http.DetectContentType(sniff[:n])
+
+	return file, Image{Hash: hash, ContentType: contentType, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (f *Filesystem) Variants(ctx context.Context, owner Owner, id uuid.UUID) ([]string, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	entries, err := os.ReadDir(filepath.Join(f.root, "refs", string(owner), id.String()))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var variants []string
+	for _, entry := range entries {
+		if variant, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			variants = append(variants, variant)
+		}
+	}
+	return variants, nil
+}
+
+func (f *Filesystem) Delete(ctx context.Context, key Key) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	ref, err := f.readRef(key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	err = os.Remove(f.refPath(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.Join(errors.New("could not remove image reference"), err)
+	}
+	if ref.Hash != "" {
+		f.collect(ref.Hash)
+	}
+	return nil
+}
+
+// collect removes the blob once no reference links to it, the caller must hold the write lock.
+// Blobs are not indexed by reference, so every reference is read. A failure only leaves the blob behind.
+func (f *Filesystem) collect(hash string) {
+	referenced := false
+	err := filepath.WalkDir(filepath.Join(f.root, "refs"), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var ref filesystemRef
+		if json.Unmarshal(raw, &ref) == nil && ref.Hash == hash {
+			referenced = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err == nil && !referenced {
+		err = os.Remove(f.blobPath(hash))
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Sugar().Warnf("Could not remove unreferenced image blob %s: %v", hash, err)
+	}
+}
+
+// writeFileAtomic writes the file through a temporary file so readers never see partial content.
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
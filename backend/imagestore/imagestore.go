@@ -0,0 +1,91 @@
+package imagestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/config"
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned when no image is stored for a key or hash.
+var ErrNotFound = errors.New("image not found")
+
+// Owner is the kind of entity an image belongs to.
+type Owner string
+
+const (
+	OwnerHero  Owner = "hero"
+	OwnerFight Owner = "fight"
+)
+
+// Key identifies one variant of an image belonging to a hero or fight.
+type Key struct {
+	Owner   Owner
+	ID      uuid.UUID
+	Variant string
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%s/%s/%s", k.Owner, k.ID, k.Variant)
+}
+
+// Image describes stored image content.
+type Image struct {
+	Hash        string
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// ETag returns the strong entity tag of the image content.
+func (i Image) ETag() string {
+	return `"` + i.Hash + `"`
+}
+
+// Content is a seekable handle on stored image bytes.
+type Content interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// Store persists images by content hash and remembers which variant belongs to which hero or fight.
+type Store interface {
+	// Put stores the content under its hash and links the key to it.
+	// The content the key linked to before is removed once no other key links to it.
+	Put(ctx context.Context, key Key, contentType string, data []byte) (Image, error)
+	// Link points the key at an already stored image, removing replaced content like Put.
+	Link(ctx context.Context, key Key, image Image) error
+	// Lookup returns the image currently linked to the key.
+	Lookup(ctx context.Context, key Key) (Image, error)
+	// Open returns the content of the image with the given hash.
+	Open(ctx context.Context, hash string) (Content, Image, error)
+	// Variants lists the variants linked for the hero or fight.
+	Variants(ctx context.Context, owner Owner, id uuid.UUID) ([]string, error)
+	// Delete unlinks the key and removes its content once no other key links to it.
+	Delete(ctx context.Context, key Key) error
+}
+
+// New creates the store selected by the configuration.
+func New(cfg config.ConfigImages, db *database.Database) (Store, error) {
+	switch cfg.Store {
+	case config.ImageStoreFilesystem:
+		return NewFilesystem(cfg.Path)
+	case config.ImageStoreDatabase, "":
+		return NewDatabase(db), nil
+	default:
+		return nil, fmt.Errorf("unknown image store %q", cfg.Store)
+	}
+}
+
+// Hash returns the content hash used to address the data.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
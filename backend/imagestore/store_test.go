@@ -0,0 +1,81 @@
+package imagestore
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFilesystemCollectsReplacedBlobs(t *testing.T) {
+	store, err := NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystem: %v", err)
+	}
+	testCollectsReplacedBlobs(t, store)
+}
+
+// testCollectsReplacedBlobs checks that a blob is removed once the last key linking to it was replaced or deleted
+func testCollectsReplacedBlobs(t *testing.T, store Store) {
+	ctx := context.Background()
+	id := uuid.New()
+	card := Key{Owner: OwnerFight, ID: id, Variant: "card"}
+	copied := Key{Owner: OwnerFight, ID: id, Variant: "copy"}
+	exists := func(hash string) bool {
+		content, _, err := store.Open(ctx, hash)
+		if err == nil {
+			content.Close()
+		} else if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Open: %v", err)
+		}
+		return err == nil
+	}
+
+	first, err := store.Put(ctx, card, "image/png", []byte("first"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	err = store.Link(ctx, copied, first)
+	if err != nil {
+		t.Fatalf("Link: %v", err)
+	}
+
+	// the blob stays while another key links to it
+	second, err := store.Put(ctx, card, "image/png", []byte("second"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !exists(first.Hash) {
+		t.Fatal("blob removed while still linked")
+	}
+	variants, err := store.Variants(ctx, OwnerFight, id)
+	slices.Sort(variants)
+	if err != nil || !slices.Equal(variants, []string{"card", "copy"}) {
+		t.Fatalf("Variants: %v %v", variants, err)
+	}
+
+	err = store.Delete(ctx, copied)
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if exists(first.Hash) {
+		t.Error("blob kept after its last key was deleted")
+	}
+	if _, err := store.Lookup(ctx, copied); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup deleted key: %v", err)
+	}
+
+	// replacing the only key removes the old blob
+	third, err := store.Put(ctx, card, "image/png", []byte("third"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if exists(second.Hash) || !exists(third.Hash) {
+		t.Error("replaced blob kept or current blob removed")
+	}
+	if err := store.Delete(ctx, Key{Owner: OwnerHero, ID: id, Variant: "missing"}); err != nil {
+		t.Errorf("Delete missing key: %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -42,3 +45,32 @@ func Sugar() *zap.SugaredLogger {
 	sugar = l.Sugar()
 	return sugar
 }
+
+type requestIDKey struct{}
+
+// WithRequestID attaches the request ID that Ctx adds to every log line
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of the context, empty outside a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Ctx returns the sugared logger with the request, trace and span ID of the context attached
+func Ctx(ctx context.Context) *zap.SugaredLogger {
+	l := Sugar()
+	if id := RequestID(ctx); id != "" {
+		l = l.With(zap.String("request_id", id))
+	}
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return l
+	}
+	return l.With(
+		zap.String("trace_id", spanContext.TraceID().String()),
+		zap.String("span_id", spanContext.SpanID().String()),
+	)
+}
@@ -3,20 +3,24 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/expki/backend/pixel-protocol/claude"
 	"github.com/expki/backend/pixel-protocol/config"
 	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/expki/backend/pixel-protocol/imagestore"
 	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/expki/backend/pixel-protocol/metrics"
+	"github.com/expki/backend/pixel-protocol/middleware"
 	"github.com/expki/backend/pixel-protocol/server"
+	"github.com/expki/backend/pixel-protocol/tracing"
 	"github.com/klauspost/compress/zstd"
 	"github.com/quic-go/quic-go/http3"
 	"go.uber.org/zap"
@@ -26,10 +30,21 @@ import (
 func main() {
 	appCtx, stopApp := context.WithCancel(context.Background())
 
+	// Subcommands, a bare config path keeps serving as before
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if run, ok := commands[args[0]]; ok {
+			os.Exit(run(args[1:]))
+		}
+		if args[0] == "serve" {
+			args = args[1:]
+		}
+	}
+
 	// Load config
 	var configPath string = "config.json"
-	if len(os.Args) > 1 {
-		configPath = os.Args[1]
+	if len(args) > 0 {
+		configPath = args[0]
 	}
 	log.Default().Printf("Config path: %s\n", configPath)
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -40,17 +55,16 @@ func main() {
 		}
 	}
 	log.Default().Println("Reading config...")
-	configRaw, err := os.ReadFile(configPath)
+	cfg, err := config.Load(configPath)
 	if err != nil {
-		log.Fatalf("ReadFile %q: %v", configPath, err)
+		log.Fatalf("Load: %v", err)
 	}
-	log.Default().Println("Parsing config...")
-	cfg, err := config.ParseConfig(configRaw)
+	err = cfg.Validate()
 	if err != nil {
-		log.Fatalf("ParseConfig: %v", err)
+		log.Fatalf("Invalid config %s:\n%v", configPath, err)
 	}
 	log.Default().Println("Loading TLS...")
-	err = cfg.TLS.Configurate()
+	err = cfg.TLS.Configurate(appCtx)
 	if err != nil {
 		log.Fatalf("Configurate: %v", err)
 	}
@@ -58,13 +72,20 @@ func main() {
 	// Logger
 	log.Default().Println("Setting log level:", cfg.LogLevel.String())
 	logConf := zap.NewDevelopmentConfig()
-	logConf.Level = cfg.LogLevel.Zap()
+	logLevel := cfg.LogLevel.Zap()
+	logConf.Level = logLevel
 	l, err := logConf.Build()
 	if err != nil {
 		log.Fatalf("zap.NewDevelopment: %v", err)
 	}
 	logger.Initialize(l)
-	defer l.Sync()
+
+	// Tracing
+	logger.Sugar().Info("Loading tracing...")
+	shutdownTracing, err := tracing.Setup(appCtx, cfg.Tracing)
+	if err != nil {
+		logger.Sugar().Fatalf("tracing.Setup: %v", err)
+	}
 
 	// Database
 	logger.Sugar().Info("Loading database...")
@@ -72,20 +93,34 @@ func main() {
 	if err != nil {
 		logger.Sugar().Fatalf("database.New: %v", err)
 	}
+	for _, pool := range db.Pools() {
+		err = metrics.RegisterDB(pool.DB, pool.Name)
+		if err != nil {
+			logger.Sugar().Errorf("metrics.RegisterDB %s: %v", pool.Name, err)
+		}
+	}
 
 	// Claude Client
 	logger.Sugar().Info("Loading Claude client...")
 	claudeClient := claude.NewClient(cfg.Claude.APIKey, cfg.Claude.Model)
 
+	// Image store
+	logger.Sugar().Info("Loading image store...")
+	images, err := imagestore.New(cfg.Images, db)
+	if err != nil {
+		logger.Sugar().Fatalf("imagestore.New: %v", err)
+	}
+
 	// Server
 	logger.Sugar().Info("Loading Server...")
-	srv := server.New(db, claudeClient)
+	srv := server.New(db, claudeClient, images, cfg.Admin)
+	health := server.NewHealth(&cfg, db, claudeClient)
 
 	// Create mux
 	mux := http.NewServeMux()
 
 	// HTTP
-	server := http.Server{
+	server1 := http.Server{
 		Handler: mux,
 		Addr:    cfg.Server.HttpAddress,
 	}
@@ -97,7 +132,7 @@ func main() {
 		TLSConfig: &tls.Config{
 			GetCertificate: cfg.TLS.GetCertificate,
 			ClientAuth:     tls.NoClientCert,
-			NextProtos:     []string{"h2", "http/1.1"}, // Enable HTTP/2
+			NextProtos:     cfg.TLS.NextProtos("h2", "http/1.1"), // Enable HTTP/2 and ACME TLS-ALPN-01
 		},
 	}
 	err = http2.ConfigureServer(&server2, &http2.Server{})
@@ -117,21 +152,15 @@ func main() {
 		QUICConfig: nil, // Use default QUIC configuration
 	}
 
+	// CORS middleware
+	cors, err := middleware.NewCORS(cfg.CORS)
+	if err != nil {
+		logger.Sugar().Fatalf("middleware.NewCORS: %v", err)
+	}
+
 	// Headers middleware
 	middlewareHeaders := func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// CORS headers for development
-			w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5081")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-			// Handle preflight requests
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-
 			// Advertise HTTP/3 support via Alt-Svc header
 			// Use the same host and port that the client connected to
 			// Since HTTP/2 and HTTP/3 run on the same port (typically 443)
@@ -158,8 +187,7 @@ func main() {
 			}
 			reader, err := zstd.NewReader(r.Body, zstd.WithDecoderLowmem(true))
 			if err != nil {
-				logger.Sugar().Errorf("Failed to create zstd reader: %v", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				server.WriteProblem(w, r, errors.Join(errors.New("failed to create zstd reader"), err))
 				return
 			}
 			defer reader.Close()
@@ -168,82 +196,71 @@ func main() {
 		})
 	}
 
-	// Compression middleware
-	middlewareCompression := func(h http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !strings.Contains(r.Header.Get("Accept-Encoding"), "zstd") {
-				h.ServeHTTP(w, r)
-				return
-			}
-			w.Header().Set("Content-Encoding", "zstd")
-			encoder, err := zstd.NewWriter(w,
-				zstd.WithEncoderLevel(zstd.SpeedDefault),
-				zstd.WithEncoderCRC(false),
-				zstd.WithEncoderConcurrency(1),
-			)
-			if err != nil {
-				logger.Sugar().Errorf("Failed to create zstd encoder: %v", err)
-				h.ServeHTTP(w, r)
-				return
-			}
-			defer encoder.Close()
-			zstrw := &zstdResponseWriter{ResponseWriter: w, Writer: encoder}
-			h.ServeHTTP(zstrw, r)
-		})
-	}
+	// Routes: Probes
+	mux.HandleFunc("GET /healthz", health.HandleHealthz)
+	mux.HandleFunc("GET /readyz", health.HandleReadyz)
+	mux.HandleFunc("GET /version", health.HandleVersion)
 
 	// Routes: Swagger documentation
-	mux.HandleFunc("/swagger", srv.HandleSwagger)
-	mux.HandleFunc("/swagger/", srv.HandleSwagger)
-	mux.HandleFunc("/swagger/swagger.json", srv.HandleSwagger)
-	mux.HandleFunc("/swagger/swagger.yaml", srv.HandleSwagger)
-
-	// Routes: API
-	playerHandler := middlewareHeaders(middlewareDecompression(middlewareCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if it's a fight-related endpoint
-		if strings.Contains(r.URL.Path, "/fight") {
-			srv.HandlePlayerFights(w, r)
-		} else {
-			srv.HandlePlayer(w, r)
-		}
-	}))))
-	heroHandler := middlewareHeaders(middlewareDecompression(middlewareCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check for fight image endpoint first (most specific)
-		if strings.Contains(r.URL.Path, "/fight/") && strings.Contains(r.URL.Path, "/image") {
-			srv.HandleFightImage(w, r)
-		} else if strings.Contains(r.URL.Path, "/fight") {
-			srv.HandleHeroFights(w, r)
-		} else if strings.Contains(r.URL.Path, "/image") {
-			srv.HandleHeroImage(w, r)
-		} else {
-			srv.HandleHero(w, r)
-		}
-	}))))
+	swagger := middleware.Compress(http.HandlerFunc(srv.HandleSwagger))
+	mux.Handle("GET /swagger", swagger)
+	mux.Handle("GET /swagger/{$}", swagger)
+	mux.Handle("GET /swagger/swagger.json", swagger)
+	mux.Handle("GET /swagger/swagger.yaml", swagger)
+	mux.Handle("GET /swagger/{version}/swagger.json", swagger)
+	mux.Handle("GET /swagger/{version}/swagger.yaml", swagger)
 
-	mux.Handle("/api/player", playerHandler)
-	mux.Handle("/api/player/", playerHandler)
-	mux.Handle("/api/hero", heroHandler)
-	mux.Handle("/api/hero/", heroHandler)
+	// Routes: API, every version under its own prefix
+	srv.Register(mux, func(h http.Handler) http.Handler {
+		return middlewareDecompression(middleware.Compress(h))
+	})
 
 	// Routes: Static
-	static := http.FileServerFS(distZstd)
-	staticZstd := http.FileServerFS(distZstd)
-	mux.Handle("/", middlewareHeaders(func() http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !strings.Contains(r.Header.Get("Accept-Encoding"), "zstd") {
-				static.ServeHTTP(w, r)
-				return
-			}
-			w.Header().Set("Content-Encoding", "zstd")
-			staticZstd.ServeHTTP(w, r)
-		})
-	}()))
+	mux.Handle("GET /", staticHandler())
+
+	// Config reload on SIGHUP and the admin listener
+	reload := &reloader{path: configPath, current: cfg, logLevel: logLevel, claude: claudeClient, cors: cors, health: health}
+
+	// Routes: Admin, kept off the public listeners when an admin address is configured.
+	// With a client CA the listener requires a verified client certificate and also serves pprof, moderation and config,
+	// without one it serves metrics and moderation behind the bearer token.
+	adminMux := http.NewServeMux()
+	adminServer := http.Server{
+		Handler: middleware.RequestID(middleware.AccessLog(middleware.Recover(adminMux))),
+		Addr:    cfg.Admin.Address,
+	}
+	switch {
+	case cfg.Admin.MutualTLS():
+		clientCAs, err := cfg.Admin.ClientCAs()
+		if err != nil {
+			logger.Sugar().Fatalf("cfg.Admin.ClientCAs: %v", err)
+		}
+		adminServer.TLSConfig = &tls.Config{
+			GetCertificate: cfg.TLS.GetCertificate,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			ClientCAs:      clientCAs,
+			MinVersion:     tls.VersionTLS12,
+		}
+		adminRoutes(adminMux, server.NewAdminAuth(cfg.Admin), srv, reload)
+	case cfg.Admin.Address != "":
+		adminMux.Handle("GET /metrics", metrics.Handler())
+		moderationRoutes(adminMux, srv, func(h http.Handler) http.Handler { return h })
+	default:
+		mux.Handle("GET /metrics", metrics.Handler())
+	}
+
+	// Wrap the mux in the CORS middleware so preflight requests are answered before method matching.
+	// Below tracing nothing may replace the request, it is the one the mux sets the matched pattern on.
+	handler := middleware.RequestID(tracing.Middleware(metrics.Middleware(middleware.AccessLog(middleware.Recover(cors.Handler(middlewareHeaders(mux)))))))
+	server1.Handler = cfg.TLS.HTTPHandler(handler) // answers ACME HTTP-01 challenges
+	server2.Handler = handler
+	server3.Handler = handler
 
 	// Start servers
 	serverDone := make(chan struct{})
 	go func() {
 		logger.Sugar().Infof("HTTP server starting on %s", cfg.Server.HttpAddress)
-		err := server.ListenAndServe()
+		err := server1.ListenAndServe()
 		if err != nil && err != http.ErrServerClosed {
 			logger.Sugar().Errorf("ListenAndServe http: %v", err)
 		}
@@ -258,6 +275,23 @@ func main() {
 		}
 		close(server2Done)
 	}()
+	adminDone := make(chan struct{})
+	if cfg.Admin.Address != "" {
+		go func() {
+			var err error
+			if adminServer.TLSConfig != nil {
+				logger.Sugar().Infof("Admin server starting on %s with client certificates", cfg.Admin.Address)
+				err = adminServer.ListenAndServeTLS("", "")
+			} else {
+				logger.Sugar().Infof("Admin server starting on %s", cfg.Admin.Address)
+				err = adminServer.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				logger.Sugar().Errorf("ListenAndServe admin: %v", err)
+			}
+			close(adminDone)
+		}()
+	}
 	server3Done := make(chan struct{})
 	go func() {
 		logger.Sugar().Infof("HTTP3 (QUIC) server starting on %s", cfg.Server.Http3Address)
@@ -268,9 +302,12 @@ func main() {
 		close(server3Done)
 	}()
 
+	// Config reload on SIGHUP
+	go reload.run(appCtx)
+
 	// Interrupt signal
 	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(interrupt, shutdownSignals...)
 
 	// Wait for servers to finish
 	select {
@@ -284,28 +321,28 @@ func main() {
 		logger.Sugar().Info("HTTP2 server stopped")
 	case <-server3Done:
 		logger.Sugar().Info("HTTP3 server stopped")
+	case <-adminDone:
+		logger.Sugar().Info("Admin server stopped")
 	}
 	logger.Sugar().Info("Server shutting down")
-	shutdownCtx, cancelShutdown := context.WithTimeout(appCtx, 3*time.Second)
-	defer cancelShutdown()
-	server.Shutdown(shutdownCtx)
-	server2.Shutdown(shutdownCtx)
-	server3.Close()
-	server.Close()
-	server2.Close()
+	drain(cfg.Server, health, srv, map[string]listener{
+		"http":  &server1,
+		"https": &server2,
+		"http3": &server3,
+	})
+
+	// Admin listener stays up during the drain so it can be observed
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelClose()
+	adminServer.Shutdown(closeCtx)
+	err = shutdownTracing(closeCtx)
+	if err != nil {
+		logger.Sugar().Errorf("Failed to flush traces: %v", err)
+	}
 	stopApp()
 	db.Close()
 	logger.Sugar().Info("Server stopped")
-}
-
-// zstdResponseWriter wraps the http.ResponseWriter to provide zstd compression
-type zstdResponseWriter struct {
-	http.ResponseWriter
-	Writer *zstd.Encoder
-}
-
-func (w *zstdResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+	l.Sync()
 }
 
 // zstdResponseWriter wraps the io.ReadClose to provide zstd decompression
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pixel_protocol"
+
+// Judge sources of a fight outcome
+const (
+	JudgeClaude   = "claude"
+	JudgeFallback = "fallback"
+)
+
+// Results of a certificate rotation
+const (
+	RotationSuccess = "success"
+	RotationFailure = "failure"
+)
+
+// Image kinds of a failed image fetch
+const (
+	ImageAvatar   = "avatar"
+	ImagePortrait = "portrait"
+	ImageCard     = "card"
+	ImageReplay   = "replay"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts served requests by route pattern, method, status code and protocol
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Served HTTP requests by route, method, status code and protocol.",
+	}, []string{"route", "method", "code", "protocol"})
+
+	// HTTPDuration observes the time to serve a request by route pattern and protocol
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time to serve HTTP requests by route and protocol.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "protocol"})
+
+	// FightOutcomes counts fights by who judged them and the outcome for the attacker
+	FightOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fight",
+		Name:      "outcomes_total",
+		Help:      "Fights by judge source and outcome from the attacker's perspective.",
+	}, []string{"judge", "outcome"})
+
+	// ClaudeRequests counts requests to the Claude API by status code, transport failures are counted as "error"
+	ClaudeRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "claude",
+		Name:      "requests_total",
+		Help:      "Requests to the Claude API by status code, \"error\" when no response arrived.",
+	}, []string{"code"})
+
+	// ClaudeDuration observes the latency of the Claude API
+	ClaudeDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "claude",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests to the Claude API.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30},
+	})
+
+	// ClaudeErrors counts narratives that could not be generated and fell back to a random outcome
+	ClaudeErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "claude",
+		Name:      "errors_total",
+		Help:      "Combat narratives the Claude API failed to generate.",
+	})
+
+	// ImageFailures counts image fetches that failed by kind of image
+	ImageFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "failures_total",
+		Help:      "Image fetches that failed to load or render by kind.",
+	}, []string{"kind"})
+
+	// CertificateRotations counts certificates reloaded from disk, a failure keeps serving the previous certificate
+	CertificateRotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "tls",
+		Name:      "certificate_rotations_total",
+		Help:      "Certificate reloads from disk by result, a failed reload keeps the previous certificate.",
+	}, []string{"result"})
+
+	// CertificateExpiry is the expiry of the certificate served for each configured certificate path
+	CertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "tls",
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "Unix time at which the loaded certificate of each certificate path expires.",
+	}, []string{"path"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		FightOutcomes,
+		ClaudeRequests,
+		ClaudeDuration,
+		ClaudeErrors,
+		ImageFailures,
+		CertificateRotations,
+		CertificateExpiry,
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of a database under the name
+func RegisterDB(db *sql.DB, name string) error {
+	return registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
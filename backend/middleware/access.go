@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/geolookup"
+	"github.com/expki/backend/pixel-protocol/logger"
+)
+
+// AccessLog writes one structured log line per request once it was served
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			// The mux sets the pattern on the request, panics are logged by Recover
+			route := "unmatched"
+			if r.Pattern != "" {
+				_, route, _ = strings.Cut(r.Pattern, " ")
+			}
+			logger.Ctx(r.Context()).Infow("request",
+				"method", r.Method,
+				"route", route,
+				"path", r.URL.Path,
+				"status", recorder.status,
+				"bytes", recorder.bytes,
+				"duration", time.Since(start),
+				"protocol", r.Proto,
+				"country", geolookup.GetClientCountry(r),
+			)
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CompressMinSize is the smallest body worth compressing, below it the coding overhead outweighs the savings
+const CompressMinSize = 1024
+
+// Compress encodes responses in the coding negotiated from Accept-Encoding.
+// Bodies below CompressMinSize, already compressed content types, bodiless statuses and responses that set their own Content-Encoding pass through.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		coding := Negotiate(r.Header.Get("Accept-Encoding"), Encodings)
+		if coding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// not deferred, a panic must leave the response unwritten for Recover
+		writer := &compressWriter{ResponseWriter: w, coding: coding, status: http.StatusOK}
+		next.ServeHTTP(writer, r)
+		writer.Close()
+	})
+}
+
+// compressWriter buffers the start of the body until it knows whether compressing pays off
+type compressWriter struct {
+	http.ResponseWriter
+	coding  string
+	status  int
+	buffer  []byte
+	decided bool
+	encoder encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided {
+		return
+	}
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	// statuses without a body never carry a coding, a 304 has to match the headers of the cached 200
+	if status == http.StatusNoContent || status == http.StatusNotModified || status < 200 {
+		w.decide(false)
+		return
+	}
+	if length, err := strconv.Atoi(w.Header().Get("Content-Length")); err == nil && length < CompressMinSize {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buffer = append(w.buffer, b...)
+		if len(w.buffer) < CompressMinSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide writes the header and the buffered body, compressed when allowed and worth it
+func (w *compressWriter) decide(allowed bool) error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buffer) > 0 {
+		// sniff the plain body now, net/http would otherwise sniff the compressed bytes
+		header.Set("Content-Type", http.DetectContentType(w.buffer))
+	}
+	if allowed && header.Get("Content-Encoding") == "" && !incompressible(header.Get("Content-Type")) {
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		header.Set("Content-Encoding", w.coding)
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			// the encoded bytes differ from the representation the strong validator names
+			header.Set("ETag", "W/"+etag)
+		}
+		w.encoder = getEncoder(w.coding, w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buffer)
+	} else {
+		_, err = w.ResponseWriter.Write(buffer)
+	}
+	return err
+}
+
+// Flush sends what was written so far, compressing it if the body already passed the threshold
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(len(w.buffer) >= CompressMinSize)
+	}
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close finishes the body, a short body is written as is
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	putEncoder(w.coding, w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// Unwrap exposes the original writer to http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/expki/backend/pixel-protocol/config"
+)
+
+// CORS answers preflight requests and echoes allowed origins, see the Fetch standard CORS protocol
+type CORS struct {
+	policy atomic.Pointer[corsPolicy]
+}
+
+// corsPolicy is a compiled ConfigCORS
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     []string
+	patterns    []originPattern
+	methods     []string
+	anyHeader   bool
+	headers     []string // lower case
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// originPattern matches an origin with a single * standing for one or more host labels
+type originPattern struct {
+	prefix string
+	suffix string
+}
+
+// NewCORS compiles the CORS policy of the config
+func NewCORS(cfg config.ConfigCORS) (*CORS, error) {
+	c := &CORS{}
+	return c, c.Update(cfg)
+}
+
+// Update swaps in the policy of the config, the current policy stays when the config is invalid
+func (c *CORS) Update(cfg config.ConfigCORS) error {
+	policy, err := compileCORS(cfg)
+	if err != nil {
+		return err
+	}
+	c.policy.Store(policy)
+	return nil
+}
+
+func compileCORS(cfg config.ConfigCORS) (*corsPolicy, error) {
+	c := &corsPolicy{
+		methods:     cfg.AllowedMethods,
+		exposed:     strings.Join(cfg.ExposedHeaders, ", "),
+		credentials: cfg.AllowCredentials,
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+		switch strings.Count(origin, "*") {
+		case 0:
+			c.origins = append(c.origins, origin)
+		case 1:
+			if origin == "*" {
+				c.anyOrigin = true
+				continue
+			}
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			if !strings.HasSuffix(prefix, "://") && !strings.HasSuffix(prefix, ".") {
+				return nil, fmt.Errorf("cors origin %q: the wildcard must cover whole host labels", origin)
+			}
+			c.patterns = append(c.patterns, originPattern{prefix: prefix, suffix: suffix})
+		default:
+			return nil, fmt.Errorf("cors origin %q: only one wildcard is allowed", origin)
+		}
+	}
+	if c.anyOrigin && c.credentials {
+		return nil, errors.New("cors: credentials cannot be allowed for any origin, list the origins instead")
+	}
+	for _, header := range cfg.AllowedHeaders {
+		if header == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headers = append(c.headers, strings.ToLower(strings.TrimSpace(header)))
+	}
+	if maxAge := cfg.MaxAge.Duration(0); maxAge > 0 {
+		c.maxAge = strconv.Itoa(int(maxAge.Seconds()))
+	}
+	return c, nil
+}
+
+// Handler applies the policy, preflight requests are answered without reaching next
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := c.policy.Load()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		header := w.Header()
+
+		// caches must key responses on the origin whenever it is echoed
+		if !policy.anyOrigin {
+			header.Add("Vary", "Origin")
+		}
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed := policy.allowOrigin(origin)
+		if !preflight {
+			if allowed {
+				policy.writeOrigin(header, origin)
+				if policy.exposed != "" {
+					header.Set("Access-Control-Expose-Headers", policy.exposed)
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// a rejected preflight carries no CORS headers, the browser blocks the request
+		method := r.Header.Get("Access-Control-Request-Method")
+		requested := splitHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+		if !allowed || !slices.Contains(policy.methods, method) || !policy.allowHeaders(requested) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		policy.writeOrigin(header, origin)
+		header.Set("Access-Control-Allow-Methods", method)
+		if len(requested) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+		if policy.maxAge != "" {
+			header.Set("Access-Control-Max-Age", policy.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (c *corsPolicy) writeOrigin(header http.Header, origin string) {
+	if c.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if c.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *corsPolicy) allowOrigin(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if slices.Contains(c.origins, origin) {
+		return true
+	}
+	for _, pattern := range c.patterns {
+		if pattern.match(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p originPattern) match(origin string) bool {
+	if len(origin) <= len(p.prefix)+len(p.suffix) || !strings.HasPrefix(origin, p.prefix) || !strings.HasSuffix(origin, p.suffix) {
+		return false
+	}
+	// the wildcard only stands for host labels, never a port, path or user info
+	labels := origin[len(p.prefix) : len(origin)-len(p.suffix)]
+	return strings.IndexFunc(labels, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.')
+	}) == -1 && !strings.HasPrefix(labels, ".") && !strings.HasSuffix(labels, ".")
+}
+
+func (c *corsPolicy) allowHeaders(requested []string) bool {
+	if c.anyHeader {
+		return true
+	}
+	for _, header := range requested {
+		if !slices.Contains(c.headers, header) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitHeaderList parses a comma separated header list into lower case names
+func splitHeaderList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings in order of server preference when the client weighs them equally
+const (
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// Encodings lists every supported content coding, most preferred first
+var Encodings = []string{EncodingZstd, EncodingBrotli, EncodingGzip}
+
+// Negotiate picks the offered coding the client weighs highest in Accept-Encoding, see RFC 9110 section 12.5.3.
+// It returns "" for identity, also when the header is missing or accepts none of the offered codings.
+func Negotiate(acceptEncoding string, offered []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	weights := map[string]float64{}
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "x-gzip" {
+			coding = EncodingGzip
+		}
+		if coding == "" {
+			continue
+		}
+		weight := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || !strings.EqualFold(key, "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			weight = parsed
+		}
+		weights[coding] = weight
+	}
+
+	best, bestWeight := "", 0.0
+	for _, coding := range offered {
+		weight, ok := weights[coding]
+		if !ok {
+			weight = weights["*"]
+		}
+		if weight > bestWeight {
+			best, bestWeight = coding, weight
+		}
+	}
+	return best
+}
+
+// encoder is a pooled compressor of one content coding
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingZstd: {New: func() any {
+		encoder, _ := zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(zstd.SpeedDefault),
+			zstd.WithEncoderCRC(false),
+			zstd.WithEncoderConcurrency(1),
+		)
+		return encoder
+	}},
+	EncodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, 5)
+	}},
+	EncodingGzip: {New: func() any {
+		encoder, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return encoder
+	}},
+}
+
+// getEncoder takes a compressor of the coding from its pool, writing to w
+func getEncoder(coding string, w io.Writer) encoder {
+	encoder := encoderPools[coding].Get().(encoder)
+	encoder.Reset(w)
+	return encoder
+}
+
+// putEncoder returns a closed compressor to its pool
+func putEncoder(coding string, encoder encoder) {
+	encoder.Reset(nil)
+	encoderPools[coding].Put(encoder)
+}
+
+// incompressible reports content types that are already compressed, compressing them again only costs CPU
+func incompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "font/woff"):
+		return true
+	}
+	switch mediaType {
+	case "application/zip", "application/gzip", "application/zstd", "application/x-brotli", "application/pdf", "application/octet-stream":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/expki/backend/pixel-protocol/server"
+	"github.com/expki/backend/pixel-protocol/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Recover turns a handler panic into a 500 problem response and logs it with the stack trace.
+// http.ErrAbortHandler keeps aborting the response as the server expects.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+			err := fmt.Errorf("panic: %v", value)
+			tracing.RecordError(trace.SpanFromContext(r.Context()), err)
+			logger.Ctx(r.Context()).Errorw("handler panicked",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", fmt.Sprint(value),
+				zap.ByteString("stack", debug.Stack()),
+			)
+			if recorder.wroteHeader {
+				// the status is already on the wire, abort so the client sees a broken response instead of a truncated success
+				panic(http.ErrAbortHandler)
+			}
+			server.WriteProblem(recorder, r, api.Internal())
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
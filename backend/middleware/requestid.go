@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/google/uuid"
+)
+
+// HeaderRequestID correlates a request across proxies, logs and the response
+const HeaderRequestID = "X-Request-ID"
+
+// RequestID propagates a well formed X-Request-ID of the caller or assigns a new one.
+// It has to wrap the tracing middleware, the context change would otherwise hide the matched pattern from it.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+			r.Header.Set(HeaderRequestID, id)
+		}
+		w.Header().Set(HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts short visible ASCII IDs so a caller cannot inject into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package pixelart
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// CardWidth is the width of a share card, the common open graph image size.
+	CardWidth = 1200
+	// CardHeight is the height of a share card.
+	CardHeight = 630
+)
+
+// Side identifies a participant of a fight.
+type Side uint8
+
+const (
+	SideNone Side = iota
+	SideAttacker
+	SideDefender
+)
+
+var (
+	cardBackground = color.NRGBA{0x14, 0x12, 0x1f, 0xff}
+	cardPanel      = color.NRGBA{0x24, 0x21, 0x36, 0xff}
+	cardText       = color.NRGBA{0xf4, 0xf1, 0xde, 0xff}
+	cardMuted      = color.NRGBA{0x9a, 0x95, 0xb5, 0xff}
+	cardWinner     = color.NRGBA{0xf7, 0xc9, 0x48, 0xff}
+	cardDraw       = color.NRGBA{0x7c, 0x8b, 0xa1, 0xff}
+)
+
+// Card is a shareable fight result card.
+type Card struct {
+	Upload       image.Image // optional image shown between the fighters
+	Attacker     Sprite
+	Defender     Sprite
+	AttackerName string
+	DefenderName string
+	Winner       Side
+	Transcript   string
+}
+
+// Image composes the card.
+func (c Card) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, CardWidth, CardHeight))
+	fill(img, img.Bounds(), cardBackground)
+
+	// outcome banner
+	banner := "DRAW"
+	bannerColor := cardDraw
+	switch c.Winner {
+	case SideAttacker:
+		banner = truncate(c.AttackerName, 20) + " WINS"
+		bannerColor = cardWinner
+	case SideDefender:
+		banner = truncate(c.DefenderName, 20) + " WINS"
+		bannerColor = cardWinner
+	}
+	banner = strings.ToUpper(banner)
+	fill(img, image.Rect(0, 0, CardWidth, 110), bannerColor)
+	scale := 6
+	for scale > 2 && textWidth(banner, scale) > CardWidth-80 {
+		scale--
+	}
+	drawText(img, banner, (CardWidth-textWidth(banner, scale))/2, (110-13*scale)/2, scale, cardBackground)
+
+	// fighters
+	const spriteSize = 22 * GridSize
+	attackerRect := image.Rect(68, 160, 68+spriteSize, 160+spriteSize)
+	defenderRect := image.Rect(CardWidth-68-spriteSize, 160, CardWidth-68, 160+spriteSize)
+	c.drawFighter(img, attackerRect, c.Attacker, c.AttackerName, c.Winner == SideAttacker)
+	c.drawFighter(img, defenderRect, c.Defender, c.DefenderName, c.Winner == SideDefender)
+
+	// uploaded image, fit into the center panel
+	panel := image.Rect(attackerRect.Max.X+48, 150, defenderRect.Min.X-48, 150+spriteSize+20)
+	fill(img, panel, cardPanel)
+	if c.Upload != nil {
+		draw.CatmullRom.Scale(img, fit(c.Upload.Bounds(), panel.Inset(8)), c.Upload, c.Upload.Bounds(), draw.Over, nil)
+	} else {
+		drawText(img, "VS", panel.Min.X+(panel.Dx()-textWidth("VS", 8))/2, panel.Min.Y+(panel.Dy()-13*8)/2, 8, cardMuted)
+	}
+
+	// transcript excerpt
+	fill(img, image.Rect(0, 500, CardWidth, CardHeight), cardPanel)
+	for i, line := range wrap(c.Transcript, (CardWidth-80)/textWidth("x", 2), 3) {
+		drawText(img, line, 40, 516+i*34, 2, cardText)
+	}
+
+	return img
+}
+
+// PNG encodes the card.
+func (c Card) PNG() ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, c.Image())
+	if err != nil {
+		return nil, errors.Join(errors.New("could not encode card png"), err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (c Card) drawFighter(img *image.RGBA, rect image.Rectangle, sprite Sprite, name string, winner bool) {
+	frame := cardPanel
+	if winner {
+		frame = cardWinner
+	}
+	fill(img, rect.Inset(-6), frame)
+	fill(img, rect, cardBackground)
+	draw.Draw(img, rect, sprite.Image(rect.Dx()), image.Point{}, draw.Over)
+	name = truncate(name, rect.Dx()/textWidth("x", 2))
+	drawText(img, name, rect.Min.X+(rect.Dx()-textWidth(name, 2))/2, rect.Max.Y+20, 2, cardText)
+}
+
+// fill paints the rectangle with a solid color.
+func fill(img draw.Image, rect image.Rectangle, c color.Color) {
+	draw.Draw(img, rect, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// fit returns the largest rectangle with the aspect ratio of src centered inside dst.
+func fit(src, dst image.Rectangle) image.Rectangle {
+	if src.Dx() == 0 || src.Dy() == 0 {
+		return image.Rectangle{}
+	}
+	width, height := dst.Dx(), src.Dy()*dst.Dx()/src.Dx()
+	if height > dst.Dy() {
+		width, height = src.Dx()*dst.Dy()/src.Dy(), dst.Dy()
+	}
+	x := dst.Min.X + (dst.Dx()-width)/2
+	y := dst.Min.Y + (dst.Dy()-height)/2
+	return image.Rect(x, y, x+width, y+height)
+}
+
+// textWidth returns the rendered width of the text in pixels.
+func textWidth(text string, scale int) int {
+	return utf8.RuneCountInString(text) * basicfont.Face7x13.Advance * scale
+}
+
+// drawText renders text with the bitmap font, upscaled with nearest neighbour sampling to keep it crisp.
+func drawText(dst draw.Image, text string, x, y, scale int, c color.Color) {
+	if text == "" {
+		return
+	}
+	face := basicfont.Face7x13
+	small := image.NewRGBA(image.Rect(0, 0, textWidth(text, 1), face.Height))
+	drawer := font.Drawer{
+		Dst:  small,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+	drawer.DrawString(text)
+	target := image.Rect(x, y, x+small.Bounds().Dx()*scale, y+small.Bounds().Dy()*scale)
+	draw.NearestNeighbor.Scale(dst, target, small, small.Bounds(), draw.Over, nil)
+}
+
+// wrap splits text into at most maxLines lines of maxChars, ending with an ellipsis when cut short.
+func wrap(text string, maxChars, maxLines int) []string {
+	var lines []string
+	var line string
+	words := strings.Fields(text)
+	for i, word := range words {
+		word = truncate(word, maxChars)
+		if line == "" {
+			line = word
+		} else if utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= maxChars {
+			line += " " + word
+		} else {
+			lines = append(lines, line)
+			line = word
+		}
+		if len(lines) == maxLines {
+			last := []rune(lines[maxLines-1])
+			lines[maxLines-1] = string(last[:min(len(last), maxChars-3)]) + "..."
+			return lines
+		}
+		if i == len(words)-1 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// truncate shortens text to maxChars runes, marking the cut with an ellipsis.
+func truncate(text string, maxChars int) string {
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	if maxChars <= 3 {
+		return string(runes[:maxChars])
+	}
+	return string(runes[:maxChars-3]) + "..."
+}
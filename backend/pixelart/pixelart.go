@@ -0,0 +1,214 @@
+package pixelart
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// GridSize is the number of sprite cells along each axis.
+	GridSize = 12
+	// MinSize is the smallest image edge that can be rendered.
+	MinSize = GridSize
+	// MaxSize is the largest image edge that can be rendered.
+	MaxSize = 1024
+)
+
+// palette indexes
+const (
+	colorBackground uint8 = iota
+	colorOutline
+	colorPrimary
+	colorSecondary
+	colorAccent
+)
+
+// Sprite is a deterministic, horizontally symmetric pixel-art sprite.
+type Sprite struct {
+	Palette color.Palette
+	Cells   [GridSize][GridSize]uint8
+}
+
+// New generates the sprite for the given seed parts.
+// The same seed always produces the same sprite.
+func New(seed ...string) Sprite {
+	hasher := sha256.New()
+	for _, part := range seed {
+		hasher.Write([]byte(part))
+		hasher.Write([]byte{0})
+	}
+	sum := hasher.Sum(nil)
+	rng := &source{state: binary.BigEndian.Uint64(sum[:8]) ^ binary.BigEndian.Uint64(sum[8:16])}
+
+	var sprite Sprite
+	sprite.Palette = newPalette(sum[16:24])
+
+	// fill the left half with body cells, denser towards the center
+	half := GridSize / 2
+	for y := 1; y < GridSize-1; y++ {
+		for x := 1; x < half; x++ {
+			threshold := 0.35 + 0.1*float64(x)/float64(half)
+			if rng.float() > threshold {
+				continue
+			}
+			switch roll := rng.float(); {
+			case roll < 0.6:
+				sprite.Cells[y][x] = colorPrimary
+			case roll < 0.9:
+				sprite.Cells[y][x] = colorSecondary
+			default:
+				sprite.Cells[y][x] = colorAccent
+			}
+		}
+		// always give the sprite a solid spine
+		if sprite.Cells[y][half-1] == colorBackground && rng.float() < 0.8 {
+			sprite.Cells[y][half-1] = colorPrimary
+		}
+	}
+
+	// eyes
+	eyeY := 2 + int(rng.next()%uint64(GridSize/3))
+	eyeX := 2 + int(rng.next()%uint64(half-3))
+	sprite.Cells[eyeY][eyeX] = colorAccent
+
+	// mirror onto the right half
+	for y := 0; y < GridSize; y++ {
+		for x := 0; x < half; x++ {
+			sprite.Cells[y][GridSize-1-x] = sprite.Cells[y][x]
+		}
+	}
+
+	// outline every empty cell touching the body
+	outlined := sprite.Cells
+	for y := 0; y < GridSize; y++ {
+		for x := 0; x < GridSize; x++ {
+			if sprite.Cells[y][x] != colorBackground {
+				continue
+			}
+			for _, d := range [4][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				nx, ny := x+d[0], y+d[1]
+				if nx < 0 || ny < 0 || nx >= GridSize || ny >= GridSize {
+					continue
+				}
+				if cell := sprite.Cells[ny][nx]; cell != colorBackground && cell != colorOutline {
+					outlined[y][x] = colorOutline
+					break
+				}
+			}
+		}
+	}
+	sprite.Cells = outlined
+
+	return sprite
+}
+
+// Image renders the sprite scaled with nearest neighbour sampling to a size x size image.
+// Any remainder that does not divide into whole cells is used as a centered border.
+func (s Sprite) Image(size int) *image.Paletted {
+	return Enlarge(s.Grid(), size)
+}
+
+// Grid renders the sprite with one pixel per cell.
+func (s Sprite) Grid() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, GridSize, GridSize), s.Palette)
+	for y := 0; y < GridSize; y++ {
+		copy(img.Pix[y*img.Stride:], s.Cells[y][:])
+	}
+	return img
+}
+
+// Enlarge scales a paletted image up to size x size by a whole factor with nearest neighbour sampling.
+// Any remainder that does not divide into whole pixels is used as a centered border of palette index 0.
+func Enlarge(src *image.Paletted, size int) *image.Paletted {
+	bounds := src.Bounds()
+	edge := max(bounds.Dx(), bounds.Dy(), 1)
+	size = min(max(size, edge), MaxSize)
+	img := image.NewPaletted(image.Rect(0, 0, size, size), src.Palette)
+	scale := size / edge
+	offsetX := (size - scale*bounds.Dx()) / 2
+	offsetY := (size - scale*bounds.Dy()) / 2
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			index := src.ColorIndexAt(bounds.Min.X+x, bounds.Min.Y+y)
+			if index == 0 {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				row := img.Pix[(offsetY+y*scale+py)*img.Stride:]
+				for px := 0; px < scale; px++ {
+					row[offsetX+x*scale+px] = index
+				}
+			}
+		}
+	}
+	return img
+}
+
+// PNG encodes the sprite as a size x size PNG.
+func (s Sprite) PNG(size int) ([]byte, error) {
+	return EncodePNG(s.Image(size))
+}
+
+// newPalette derives a harmonious palette from the seed bytes.
+func newPalette(seed []byte) color.Palette {
+	hue := float64(binary.BigEndian.Uint16(seed[0:2])) / math.MaxUint16 * 360
+	offset := 90 + float64(seed[2])/math.MaxUint8*180
+	saturation := 0.55 + float64(seed[3])/math.MaxUint8*0.35
+	return color.Palette{
+		colorBackground: color.NRGBA{0, 0, 0, 0},
+		colorOutline:    hsl(hue, saturation*0.5, 0.12),
+		colorPrimary:    hsl(hue, saturation, 0.55),
+		colorSecondary:  hsl(math.Mod(hue+30, 360), saturation, 0.38),
+		colorAccent:     hsl(math.Mod(hue+offset, 360), 0.9, 0.65),
+	}
+}
+
+// hsl converts a hue (degrees), saturation and lightness (0-1) to an opaque color.
+func hsl(h, s, l float64) color.NRGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.NRGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 255,
+	}
+}
+
+// source is a small deterministic xorshift generator, math/rand is not guaranteed stable across go versions.
+type source struct {
+	state uint64
+}
+
+func (s *source) next() uint64 {
+	if s.state == 0 {
+		s.state = 0x9E3779B97F4A7C15
+	}
+	s.state ^= s.state << 13
+	s.state ^= s.state >> 7
+	s.state ^= s.state << 17
+	return s.state
+}
+
+func (s *source) float() float64 {
+	return float64(s.next()>>11) / (1 << 53)
+}
@@ -0,0 +1,79 @@
+package pixelart
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// PortraitSize is the edge length in pixels of a pixelated portrait before scaling.
+const PortraitSize = 48
+
+// PortraitPalette is the fixed retro palette portraits are reduced to, index 0 is transparent.
+var PortraitPalette = color.Palette{
+	color.NRGBA{0x00, 0x00, 0x00, 0x00},
+	color.NRGBA{0x00, 0x00, 0x00, 0xff},
+	color.NRGBA{0x1d, 0x2b, 0x53, 0xff},
+	color.NRGBA{0x7e, 0x25, 0x53, 0xff},
+	color.NRGBA{0x00, 0x87, 0x51, 0xff},
+	color.NRGBA{0xab, 0x52, 0x36, 0xff},
+	color.NRGBA{0x5f, 0x57, 0x4f, 0xff},
+	color.NRGBA{0xc2, 0xc3, 0xc7, 0xff},
+	color.NRGBA{0xff, 0xf1, 0xe8, 0xff},
+	color.NRGBA{0xff, 0x00, 0x4d, 0xff},
+	color.NRGBA{0xff, 0xa3, 0x00, 0xff},
+	color.NRGBA{0xff, 0xec, 0x27, 0xff},
+	color.NRGBA{0x00, 0xe4, 0x36, 0xff},
+	color.NRGBA{0x29, 0xad, 0xff, 0xff},
+	color.NRGBA{0x83, 0x76, 0x9c, 0xff},
+	color.NRGBA{0xff, 0x77, 0xa8, 0xff},
+	color.NRGBA{0xff, 0xcc, 0xaa, 0xff},
+}
+
+// Pixelate crops the image to a centered square, downscales it to PortraitSize and reduces it to the PortraitPalette.
+// Only pixel data survives, metadata such as EXIF is dropped.
+func Pixelate(src image.Image) *image.Paletted {
+	bounds := src.Bounds()
+	edge := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, edge, edge).Add(bounds.Min).Add(image.Pt((bounds.Dx()-edge)/2, (bounds.Dy()-edge)/2))
+
+	small := image.NewNRGBA(image.Rect(0, 0, PortraitSize, PortraitSize))
+	draw.CatmullRom.Scale(small, small.Bounds(), src, crop, draw.Src, nil)
+
+	portrait := image.NewPaletted(small.Bounds(), PortraitPalette)
+	opaque := PortraitPalette[1:]
+	for y := 0; y < PortraitSize; y++ {
+		for x := 0; x < PortraitSize; x++ {
+			pixel := small.NRGBAAt(x, y)
+			if pixel.A < 0x80 {
+				continue // index 0 is transparent
+			}
+			pixel.A = 0xff
+			portrait.SetColorIndex(x, y, uint8(1+opaque.Index(pixel)))
+		}
+	}
+	return portrait
+}
+
+// Scale enlarges a paletted image to size x size with nearest neighbour sampling.
+func Scale(src *image.Paletted, size int) *image.Paletted {
+	size = min(max(size, 1), MaxSize)
+	dst := image.NewPaletted(image.Rect(0, 0, size, size), src.Palette)
+	draw.NearestNeighbor.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// EncodePNG encodes a paletted image as PNG.
+func EncodePNG(img *image.Paletted) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	err := encoder.Encode(&buf, img)
+	if err != nil {
+		return nil, errors.Join(errors.New("could not encode png"), err)
+	}
+	return buf.Bytes(), nil
+}
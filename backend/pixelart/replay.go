@@ -0,0 +1,261 @@
+package pixelart
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+)
+
+const (
+	// ReplayWidth is the width of a replay animation.
+	ReplayWidth = 320
+	// ReplayHeight is the height of a replay animation.
+	ReplayHeight = 160
+
+	replayScale  = 8 // pixels per sprite cell
+	replayGround = 140
+)
+
+// replay palette indexes, sprite palettes follow after these
+const (
+	replayBackground uint8 = iota
+	replayGroundColor
+	replayFlash
+	replayHealth
+	replayDamage
+)
+
+// Round is one exchange of blows in a fight.
+type Round struct {
+	Striker Side
+	Hit     bool
+}
+
+// NewRounds deterministically derives the exchanges of a fight from its seed.
+// The winner always lands more hits than the loser, a draw ends level.
+func NewRounds(seed string, winner Side) []Round {
+	sum := sha256.Sum256([]byte(seed))
+	rng := &source{state: binary.BigEndian.Uint64(sum[:8])}
+	count := 3 + int(rng.next()%3)
+	rounds := make([]Round, count)
+	hits := map[Side]int{}
+	for i := range rounds {
+		striker := SideAttacker
+		if i%2 == 1 {
+			striker = SideDefender
+		}
+		rounds[i] = Round{Striker: striker, Hit: rng.float() < 0.6}
+		if rounds[i].Hit {
+			hits[striker]++
+		}
+	}
+
+	// settle the score so the rounds agree with the outcome
+	loser := SideNone
+	switch winner {
+	case SideAttacker:
+		loser = SideDefender
+	case SideDefender:
+		loser = SideAttacker
+	}
+	for i := len(rounds) - 1; i >= 0 && winner != SideNone && hits[winner] <= hits[loser]; i-- {
+		round := &rounds[i]
+		if round.Striker == loser && round.Hit {
+			round.Hit = false
+			hits[loser]--
+		} else if round.Striker == winner && !round.Hit {
+			round.Hit = true
+			hits[winner]++
+		}
+	}
+	for i := len(rounds) - 1; i >= 0 && winner == SideNone && hits[SideAttacker] != hits[SideDefender]; i-- {
+		round := &rounds[i]
+		if round.Hit && hits[round.Striker] > hits[opponent(round.Striker)] {
+			round.Hit = false
+			hits[round.Striker]--
+		}
+	}
+	return rounds
+}
+
+// Replay is an animation of two sprites fighting.
+type Replay struct {
+	Attacker Sprite
+	Defender Sprite
+	Winner   Side
+	Rounds   []Round
+}
+
+// fighterState is the pose of one fighter in a frame.
+type fighterState struct {
+	x, y   int
+	flash  bool
+	health int
+	fallen bool
+}
+
+// GIF renders the replay as a looping animated GIF.
+func (r Replay) GIF() ([]byte, error) {
+	palette := color.Palette{
+		replayBackground:  color.NRGBA{0x14, 0x12, 0x1f, 0xff},
+		replayGroundColor: color.NRGBA{0x24, 0x21, 0x36, 0xff},
+		replayFlash:       color.NRGBA{0xff, 0xff, 0xff, 0xff},
+		replayHealth:      color.NRGBA{0x5f, 0xd3, 0x6b, 0xff},
+		replayDamage:      color.NRGBA{0xd9, 0x4a, 0x4a, 0xff},
+	}
+	attackerOffset := uint8(len(palette))
+	palette = append(palette, r.Attacker.Palette...)
+	defenderOffset := uint8(len(palette))
+	palette = append(palette, r.Defender.Palette...)
+
+	spriteSize := GridSize * replayScale
+	home := map[Side]int{
+		SideAttacker: 40,
+		SideDefender: ReplayWidth - 40 - spriteSize,
+	}
+	// every hit takes one point, the loser is left with none
+	maxHealth := map[Side]int{SideAttacker: 1, SideDefender: 1}
+	for _, round := range r.Rounds {
+		if round.Hit {
+			maxHealth[opponent(round.Striker)]++
+		}
+	}
+	if loser := opponent(r.Winner); loser != SideNone && maxHealth[loser] > 1 {
+		maxHealth[loser]--
+	}
+	state := map[Side]*fighterState{
+		SideAttacker: {x: home[SideAttacker], y: replayGround - spriteSize, health: maxHealth[SideAttacker]},
+		SideDefender: {x: home[SideDefender], y: replayGround - spriteSize, health: maxHealth[SideDefender]},
+	}
+
+	animation := &gif.GIF{LoopCount: 0}
+	frame := func(delay int) {
+		img := image.NewPaletted(image.Rect(0, 0, ReplayWidth, ReplayHeight), palette)
+		for i := range img.Pix {
+			img.Pix[i] = replayBackground
+		}
+		fillIndex(img, image.Rect(0, replayGround, ReplayWidth, ReplayHeight), replayGroundColor)
+		for _, side := range []Side{SideAttacker, SideDefender} {
+			sprite, offset := r.Attacker, attackerOffset
+			if side == SideDefender {
+				sprite, offset = r.Defender, defenderOffset
+			}
+			fighter := state[side]
+			drawSprite(img, sprite, offset, fighter, side == SideDefender)
+			// health bar
+			bar := image.Rect(home[side], 10, home[side]+spriteSize, 16)
+			fillIndex(img, bar, replayDamage)
+			fillIndex(img, image.Rect(bar.Min.X, bar.Min.Y, bar.Min.X+bar.Dx()*fighter.health/maxHealth[side], bar.Max.Y), replayHealth)
+		}
+		animation.Image = append(animation.Image, img)
+		animation.Delay = append(animation.Delay, delay)
+	}
+
+	// intro
+	frame(60)
+	for _, round := range r.Rounds {
+		striker, target := state[round.Striker], state[opponent(round.Striker)]
+		direction := 1
+		if round.Striker == SideDefender {
+			direction = -1
+		}
+		// lunge
+		for _, step := range []int{16, 36, 56} {
+			striker.x = home[round.Striker] + direction*step
+			frame(6)
+		}
+		// impact or dodge
+		if round.Hit {
+			target.flash = true
+			target.x += direction * 12
+			target.health--
+			frame(10)
+			target.flash = false
+			frame(8)
+		} else {
+			target.y -= 24
+			frame(10)
+			target.y += 24
+		}
+		// return
+		striker.x = home[round.Striker] + direction*20
+		target.x = home[opponent(round.Striker)]
+		frame(6)
+		striker.x = home[round.Striker]
+		frame(20)
+	}
+
+	// finale, the loser topples and the winner hops
+	switch r.Winner {
+	case SideAttacker, SideDefender:
+		state[opponent(r.Winner)].fallen = true
+		for i := 0; i < 3; i++ {
+			state[r.Winner].y -= 12
+			frame(12)
+			state[r.Winner].y += 12
+			frame(12)
+		}
+	default:
+		frame(12)
+	}
+	animation.Delay[len(animation.Delay)-1] = 200
+
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, animation)
+	if err != nil {
+		return nil, errors.Join(errors.New("could not encode replay gif"), err)
+	}
+	return buf.Bytes(), nil
+}
+
+// drawSprite draws the sprite cells with the palette offset, mirrored for the fighter facing left.
+func drawSprite(img *image.Paletted, sprite Sprite, offset uint8, fighter *fighterState, mirror bool) {
+	for y := 0; y < GridSize; y++ {
+		for x := 0; x < GridSize; x++ {
+			cell := sprite.Cells[y][x]
+			if mirror {
+				cell = sprite.Cells[y][GridSize-1-x]
+			}
+			if cell == colorBackground {
+				continue
+			}
+			index := offset + cell
+			if fighter.flash {
+				index = replayFlash
+			}
+			rect := image.Rect(x*replayScale, y*replayScale, (x+1)*replayScale, (y+1)*replayScale)
+			if fighter.fallen {
+				// squash the sprite flat onto the ground
+				top := GridSize * replayScale / 2
+				rect = image.Rect(x*replayScale, top+y*replayScale/2, (x+1)*replayScale, top+(y+1)*replayScale/2)
+			}
+			fillIndex(img, rect.Add(image.Pt(fighter.x, fighter.y)), index)
+		}
+	}
+}
+
+// fillIndex paints the rectangle with a palette index.
+func fillIndex(img *image.Paletted, rect image.Rectangle, index uint8) {
+	rect = rect.Intersect(img.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			row[x] = index
+		}
+	}
+}
+
+func opponent(side Side) Side {
+	switch side {
+	case SideAttacker:
+		return SideDefender
+	case SideDefender:
+		return SideAttacker
+	default:
+		return SideNone
+	}
+}
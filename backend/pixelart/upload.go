@@ -0,0 +1,88 @@
+package pixelart
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Upload limits bound the decoded size of uploaded images to guard against decompression bombs.
+// A pixel decodes to 4 bytes or more, so each limit stays close to what its use needs.
+const (
+	// MaxUploadPixels limits portrait uploads, which are pixelated to PortraitSize.
+	MaxUploadPixels = 40_000_000
+	// MaxCardUploadPixels limits the image placed on a CardWidth x CardHeight card.
+	MaxCardUploadPixels = 4_000_000
+)
+
+// ErrUnsupportedImage is returned when an upload is not a PNG, JPEG or GIF image.
+var ErrUnsupportedImage = errors.New("unsupported image format, expected png, jpeg or gif")
+
+// Format is an image encoding recognized by its magic bytes.
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+	FormatGIF  Format = "gif"
+)
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Sniff detects the image format from the magic bytes at the start of the data.
+// The content type claimed by the client is never trusted.
+func Sniff(data []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, nil
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return FormatJPEG, nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF, nil
+	default:
+		return "", ErrUnsupportedImage
+	}
+}
+
+// DecodeUpload validates and decodes an uploaded image of at most maxPixels pixels.
+func DecodeUpload(data []byte, maxPixels int) (image.Image, Format, error) {
+	format, err := Sniff(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// check dimensions before allocating the full image
+	var decodeConfig func([]byte) (image.Config, error)
+	var decode func([]byte) (image.Image, error)
+	switch format {
+	case FormatPNG:
+		decodeConfig = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+	case FormatJPEG:
+		decodeConfig = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+	case FormatGIF:
+		decodeConfig = func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) }
+	}
+	config, err := decodeConfig(data)
+	if err != nil {
+		return nil, "", errors.Join(fmt.Errorf("could not read %s header", format), err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, "", fmt.Errorf("image dimensions %dx%d are not allowed", config.Width, config.Height)
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		return nil, "", errors.Join(fmt.Errorf("could not decode %s", format), err)
+	}
+	return img, format, nil
+}
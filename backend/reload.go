@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/claude"
+	"github.com/expki/backend/pixel-protocol/config"
+	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/expki/backend/pixel-protocol/middleware"
+	"github.com/expki/backend/pixel-protocol/server"
+	"go.uber.org/zap"
+)
+
+// configWatchInterval is how often the config file is checked for changes when watching is enabled
+const configWatchInterval = 5 * time.Second
+
+// reloadable lists the config keys applied without a restart, a key ending in . covers its whole section
+var reloadable = []string{"log_level", "claude.api_key", "claude.model", "cors."}
+
+// reloader re-reads the config on SIGHUP or file change and swaps the reloadable settings in place
+type reloader struct {
+	mutex    sync.Mutex // serializes reloads and guards current
+	path     string
+	current  config.Config // the effective config, only the reloadable keys ever change
+	logLevel zap.AtomicLevel
+	claude   *claude.Client
+	cors     *middleware.CORS
+	health   *server.Health
+}
+
+// run reloads until ctx is done
+func (r *reloader) run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var tick <-chan time.Time
+	var modTime time.Time
+	if r.current.Server.WatchConfig {
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+		if info, err := os.Stat(r.path); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			r.reload("SIGHUP")
+		case <-tick:
+			info, err := os.Stat(r.path)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			r.reload("file change")
+		}
+	}
+}
+
+// reload applies the reloadable changes of the config file, an unreadable or invalid file keeps the current config
+func (r *reloader) reload(trigger string) (applied []string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	next, err := config.Load(r.path)
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		logger.Sugar().Errorf("Config reload on %s failed, keeping the current config: %v", trigger, err)
+		return nil, err
+	}
+
+	for _, key := range changedKeys(r.current, next) {
+		if !isReloadable(key) {
+			logger.Sugar().Warnf("Config %s changed, restart to apply it", key)
+			continue
+		}
+		applied = append(applied, key)
+	}
+	if len(applied) == 0 {
+		logger.Sugar().Infof("Config reload on %s: nothing to apply", trigger)
+		return nil, nil
+	}
+
+	changed := func(prefix string) bool {
+		return slices.ContainsFunc(applied, func(key string) bool { return strings.HasPrefix(key, prefix) })
+	}
+	// CORS is compiled first, it is the only setting that can still be rejected
+	if changed("cors.") {
+		err = r.cors.Update(next.CORS)
+		if err != nil {
+			logger.Sugar().Errorf("Config reload on %s failed, keeping the current config: %v", trigger, err)
+			return nil, err
+		}
+		r.current.CORS = next.CORS
+	}
+	if changed("log_level") {
+		r.logLevel.SetLevel(next.LogLevel.Zap().Level())
+		r.current.LogLevel = next.LogLevel
+	}
+	if changed("claude.") {
+		r.claude.Configure(next.Claude.APIKey, next.Claude.Model)
+		r.current.Claude.APIKey = next.Claude.APIKey
+		r.current.Claude.Model = next.Claude.Model
+	}
+	r.health.SetConfig(&r.current)
+	logger.Sugar().Infof("Config reload on %s applied %s", trigger, strings.Join(applied, ", "))
+	return applied, nil
+}
+
+// HandleConfig serves the effective config without secrets
+func (r *reloader) HandleConfig(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	current := r.current.Redacted()
+	r.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// HandleReload reloads the config file like SIGHUP and lists the applied keys
+func (r *reloader) HandleReload(w http.ResponseWriter, req *http.Request) {
+	applied, err := r.reload("admin request by " + server.AdminSubject(req.Context()))
+	if err != nil {
+		server.WriteProblem(w, req, api.InvalidRequest(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"applied": applied})
+}
+
+// changedKeys lists the keys that differ down to the fields of each section, e.g. server.http_address
+func changedKeys(current, next config.Config) []string {
+	var keys []string
+	currentValue, nextValue := reflect.ValueOf(current), reflect.ValueOf(next)
+	for idx := 0; idx < currentValue.NumField(); idx++ {
+		field := currentValue.Type().Field(idx)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Type.Kind() != reflect.Struct {
+			if !sameJSON(currentValue.Field(idx).Interface(), nextValue.Field(idx).Interface()) {
+				keys = append(keys, name)
+			}
+			continue
+		}
+		for sub := 0; sub < field.Type.NumField(); sub++ {
+			subField := field.Type.Field(sub)
+			subName, _, _ := strings.Cut(subField.Tag.Get("json"), ",")
+			if !subField.IsExported() || subName == "-" {
+				continue
+			}
+			if !sameJSON(currentValue.Field(idx).Field(sub).Interface(), nextValue.Field(idx).Field(sub).Interface()) {
+				keys = append(keys, name+"."+subName)
+			}
+		}
+	}
+	return keys
+}
+
+// sameJSON compares values as they are written in the config, nil and empty lists are equal
+func sameJSON(a, b any) bool {
+	rawA, errA := json.Marshal(a)
+	rawB, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return string(rawA) == string(rawB) || (isEmptyList(rawA) && isEmptyList(rawB))
+}
+
+func isEmptyList(raw []byte) bool {
+	return string(raw) == "null" || string(raw) == "[]"
+}
+
+func isReloadable(key string) bool {
+	for _, prefix := range reloadable {
+		if key == prefix || strings.HasSuffix(prefix, ".") && strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
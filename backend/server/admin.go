@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/config"
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/expki/backend/pixel-protocol/imagestore"
+	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// HandleAdminPortraits handles GET /api/admin/portraits
+func (s *Server) HandleAdminPortraits(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	s.listPendingPortraits(w, r)
+}
+
+// HandleAdminPortraitImage handles GET /api/admin/portraits/{portraitId}/image
+func (s *Server) HandleAdminPortraitImage(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	portraitID, err := uuid.Parse(r.PathValue("portraitId"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid portrait ID"))
+		return
+	}
+	s.getPortraitImage(w, r, portraitID)
+}
+
+// HandleAdminPortraitApprove handles POST /api/admin/portraits/{portraitId}/approve
+func (s *Server) HandleAdminPortraitApprove(w http.ResponseWriter, r *http.Request) {
+	s.handlePortraitReview(w, r, database.PortraitStatus_Approved)
+}
+
+// HandleAdminPortraitReject handles POST /api/admin/portraits/{portraitId}/reject
+func (s *Server) HandleAdminPortraitReject(w http.ResponseWriter, r *http.Request) {
+	s.handlePortraitReview(w, r, database.PortraitStatus_Rejected)
+}
+
+func (s *Server) handlePortraitReview(w http.ResponseWriter, r *http.Request, status database.PortraitStatus) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	portraitID, err := uuid.Parse(r.PathValue("portraitId"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid portrait ID"))
+		return
+	}
+	s.reviewPortrait(w, r, portraitID, status)
+}
+
+// authorizeAdmin admits requests of the mutual TLS admin listener, AdminAuth.Require already checked their role.
+// Otherwise it checks the bearer token, on the public listeners or the admin listener without client certificates.
+// The endpoints are disabled when no token is configured and the token is never accepted once client certificates are.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := r.Context().Value(adminSubjectKey{}).(string); ok {
+		return true
+	}
+	if s.admin.MutualTLS() || s.admin.Token == "" {
+		WriteProblem(w, r, api.NotFound("Not found"))
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.admin.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		WriteProblem(w, r, api.Unauthorized("Unauthorized"))
+		return false
+	}
+	return true
+}
+
+func (s *Server) listPendingPortraits(w http.ResponseWriter, r *http.Request) {
+	var portraits []database.HeroPortrait
+	err := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
+		Where("status = ?", database.PortraitStatus_Pending).
+		Order("uploaded_at ASC").
+		Find(&portraits).Error
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to list pending portraits: %v", err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.NewPortraits(portraits))
+}
+
+func (s *Server) getPortraitImage(w http.ResponseWriter, r *http.Request, portraitID uuid.UUID) {
+	var portrait database.HeroPortrait
+	err := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
+		Where("id = ?", portraitID).
+		First(&portrait).Error
+	if err != nil {
+		WriteProblem(w, r, api.NotFound("Portrait not found"))
+		return
+	}
+
+	stored, err := s.images.Lookup(r.Context(), imagestore.Key{
+		Owner:   imagestore.OwnerHero,
+		ID:      portrait.HeroID,
+		Variant: "portrait-" + portrait.Hash,
+	})
+	if errors.Is(err, imagestore.ErrNotFound) {
+		WriteProblem(w, r, api.NotFound("Portrait image not found"))
+		return
+	} else if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to lookup portrait image: %v", err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+
+	s.serveStoredImage(w, r, stored, "private, no-store")
+}
+
+func (s *Server) reviewPortrait(w http.ResponseWriter, r *http.Request, portraitID uuid.UUID, status database.PortraitStatus) {
+	now := time.Now()
+	result := s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).
+		Model(&database.HeroPortrait{}).
+		Where("id = ? AND status = ?", portraitID, database.PortraitStatus_Pending).
+		Updates(map[string]any{"status": status, "reviewed_at": now})
+	if result.Error != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to review portrait: %v", result.Error)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+	if result.RowsAffected == 0 {
+		WriteProblem(w, r, api.NotFound("Portrait not found or already reviewed"))
+		return
+	}
+
+	var portrait database.HeroPortrait
+	err := s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).
+		Where("id = ?", portraitID).
+		First(&portrait).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		WriteProblem(w, r, api.NotFound("Portrait not found"))
+		return
+	} else if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to get portrait: %v", err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+
+	logger.Ctx(r.Context()).Infof("Portrait %s of hero %s %s", portrait.ID, portrait.HeroID, portrait.Status)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.NewPortrait(portrait))
+}
+
+// adminSubjectKey holds the client certificate subject of a request AdminAuth.Require let through
+type adminSubjectKey struct{}
+
+// AdminAuth maps the verified client certificate of the admin listener to its roles
+type AdminAuth struct {
+	roles map[string][]config.AdminRole
+}
+
+func NewAdminAuth(cfg config.ConfigAdmin) *AdminAuth {
+	return &AdminAuth{roles: cfg.Roles}
+}
+
+// AdminSubject returns the client certificate subject of an admin listener request, empty otherwise
+func AdminSubject(ctx context.Context) string {
+	subject, _ := ctx.Value(adminSubjectKey{}).(string)
+	return subject
+}
+
+// Require serves next only to clients whose certificate subject holds the role, the full subject is looked up before the common name
+func (a *AdminAuth) Require(role config.AdminRole, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			WriteProblem(w, r, api.Unauthorized("Client certificate required"))
+			return
+		}
+		subject := r.TLS.VerifiedChains[0][0].Subject
+		roles, ok := a.roles[subject.String()]
+		if !ok {
+			roles = a.roles[subject.CommonName]
+		}
+		if !slices.Contains(roles, role) {
+			logger.Ctx(r.Context()).Warnf("Admin client %q lacks the %s role for %s %s", subject.String(), role, r.Method, r.URL.Path)
+			WriteProblem(w, r, api.Forbidden("Missing the "+string(role)+" role"))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminSubjectKey{}, subject.String())))
+	})
+}
@@ -9,95 +9,76 @@ import (
 	"io"
 	"math"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/expki/backend/pixel-protocol/api"
 	"github.com/expki/backend/pixel-protocol/database"
 	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/expki/backend/pixel-protocol/metrics"
+	"github.com/expki/backend/pixel-protocol/tracing"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/plugin/dbresolver"
 )
 
-type FightsResponse struct {
-	Fights     []database.Fight `json:"fights"`
-	HasMore    bool             `json:"has_more"`
-	NextCursor string           `json:"next_cursor,omitempty"`
-}
-
-// HandlePlayerFights handles /api/player/:id/fight and /api/player/:id/fight/:fightId
+// HandlePlayerFights handles GET /api/player/{id}/fights
 func (s *Server) HandlePlayerFights(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	playerID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid player ID"))
 		return
 	}
+	s.getPlayerFights(w, r, playerID)
+}
 
-	path := strings.TrimPrefix(r.URL.Path, "/api/player/")
-	segments := strings.Split(path, "/")
-
-	if len(segments) < 2 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+// HandlePlayerFight handles GET /api/player/{id}/fight/{fightId}
+func (s *Server) HandlePlayerFight(w http.ResponseWriter, r *http.Request) {
+	playerID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid player ID"))
 		return
 	}
-
-	playerID, err := uuid.Parse(segments[0])
+	fightID, err := uuid.Parse(r.PathValue("fightId"))
 	if err != nil {
-		http.Error(w, "Invalid player ID", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Invalid fight ID"))
 		return
 	}
-
-	// Check if it's for fights list or specific fight
-	if segments[1] == "fights" {
-		s.getPlayerFights(w, r, playerID)
-	} else if segments[1] == "fight" && len(segments) > 2 {
-		fightID, err := uuid.Parse(segments[2])
-		if err != nil {
-			http.Error(w, "Invalid fight ID", http.StatusBadRequest)
-			return
-		}
-		s.getPlayerFight(w, r, playerID, fightID)
-	} else {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
-	}
+	s.getPlayerFight(w, r, playerID, fightID)
 }
 
-// HandleHeroFights handles /api/hero/:id/fights and /api/hero/:id/fight/:fightId
+// HandleHeroFights handles GET /api/hero/{id}/fights
 func (s *Server) HandleHeroFights(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/api/hero/")
-	segments := strings.Split(path, "/")
-
-	if len(segments) < 2 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+	heroID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid hero ID"))
 		return
 	}
+	s.getHeroFights(w, r, heroID)
+}
 
-	heroID, err := uuid.Parse(segments[0])
+// HandleHeroFight handles GET /api/hero/{id}/fight/{fightId}
+func (s *Server) HandleHeroFight(w http.ResponseWriter, r *http.Request) {
+	heroID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid hero ID"))
+		return
+	}
+	fightID, err := uuid.Parse(r.PathValue("fightId"))
 	if err != nil {
-		http.Error(w, "Invalid hero ID", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Invalid fight ID"))
 		return
 	}
+	s.getHeroFight(w, r, heroID, fightID)
+}
 
-	// Handle different methods and paths
-	if r.Method == http.MethodPost && segments[1] == "fight" {
-		// POST /api/hero/:id/fight - Create a new fight
-		s.createHeroFight(w, r, heroID)
-	} else if r.Method == http.MethodGet {
-		// Check if it's for fights list or specific fight
-		if segments[1] == "fights" {
-			s.getHeroFights(w, r, heroID)
-		} else if segments[1] == "fight" && len(segments) > 2 {
-			fightID, err := uuid.Parse(segments[2])
-			if err != nil {
-				http.Error(w, "Invalid fight ID", http.StatusBadRequest)
-				return
-			}
-			s.getHeroFight(w, r, heroID, fightID)
-		} else {
-			http.Error(w, "Invalid path", http.StatusBadRequest)
-		}
-	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// HandleCreateFight handles POST /api/hero/{id}/fight
+func (s *Server) HandleCreateFight(w http.ResponseWriter, r *http.Request) {
+	heroID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid hero ID"))
+		return
 	}
+	s.createHeroFight(w, r, heroID)
 }
 
 func (s *Server) getPlayerFights(w http.ResponseWriter, r *http.Request, playerID uuid.UUID) {
@@ -109,7 +90,7 @@ func (s *Server) getPlayerFights(w http.ResponseWriter, r *http.Request, playerI
 	if err := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
 		Where("id = ? AND deleted_at IS NULL", playerID).
 		First(&player).Error; err != nil {
-		http.Error(w, "Player not found", http.StatusNotFound)
+		WriteProblem(w, r, api.NotFound("Player not found"))
 		return
 	}
 
@@ -122,8 +103,8 @@ func (s *Server) getPlayerFights(w http.ResponseWriter, r *http.Request, playerI
 
 	if len(heroIDs) == 0 {
 		// No heroes, return empty fights
-		response := FightsResponse{
-			Fights:  []database.Fight{},
+		response := api.FightsResponse{
+			Fights:  []api.Fight{},
 			HasMore: false,
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -144,7 +125,7 @@ func (s *Server) getPlayerFights(w http.ResponseWriter, r *http.Request, playerI
 	if lastIDStr != "" {
 		lastID, err := uuid.Parse(lastIDStr)
 		if err != nil {
-			http.Error(w, "Invalid last_id", http.StatusBadRequest)
+			WriteProblem(w, r, api.InvalidRequest("Invalid last_id"))
 			return
 		}
 
@@ -161,8 +142,8 @@ func (s *Server) getPlayerFights(w http.ResponseWriter, r *http.Request, playerI
 
 	var fights []database.Fight
 	if err := query.Find(&fights).Error; err != nil {
-		logger.Sugar().Errorf("Failed to get fights: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Ctx(r.Context()).Errorf("Failed to get fights: %v", err)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
@@ -172,8 +153,8 @@ func (s *Server) getPlayerFights(w http.ResponseWriter, r *http.Request, playerI
 		fights = fights[:20] // Remove the extra one
 	}
 
-	response := FightsResponse{
-		Fights:  fights,
+	response := api.FightsResponse{
+		Fights:  api.NewFights(fights),
 		HasMore: hasMore,
 	}
 
@@ -195,7 +176,7 @@ func (s *Server) getHeroFights(w http.ResponseWriter, r *http.Request, heroID uu
 	if err := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
 		Where("id = ? AND deleted_at IS NULL", heroID).
 		First(&hero).Error; err != nil {
-		http.Error(w, "Hero not found", http.StatusNotFound)
+		WriteProblem(w, r, api.NotFound("Hero not found"))
 		return
 	}
 
@@ -212,7 +193,7 @@ func (s *Server) getHeroFights(w http.ResponseWriter, r *http.Request, heroID uu
 	if lastIDStr != "" {
 		lastID, err := uuid.Parse(lastIDStr)
 		if err != nil {
-			http.Error(w, "Invalid last_id", http.StatusBadRequest)
+			WriteProblem(w, r, api.InvalidRequest("Invalid last_id"))
 			return
 		}
 
@@ -229,8 +210,8 @@ func (s *Server) getHeroFights(w http.ResponseWriter, r *http.Request, heroID uu
 
 	var fights []database.Fight
 	if err := query.Find(&fights).Error; err != nil {
-		logger.Sugar().Errorf("Failed to get fights: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Ctx(r.Context()).Errorf("Failed to get fights: %v", err)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
@@ -240,8 +221,8 @@ func (s *Server) getHeroFights(w http.ResponseWriter, r *http.Request, heroID uu
 		fights = fights[:20] // Remove the extra one
 	}
 
-	response := FightsResponse{
-		Fights:  fights,
+	response := api.FightsResponse{
+		Fights:  api.NewFights(fights),
 		HasMore: hasMore,
 	}
 
@@ -260,7 +241,7 @@ func (s *Server) getPlayerFight(w http.ResponseWriter, r *http.Request, playerID
 	if err := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
 		Where("id = ? AND deleted_at IS NULL", playerID).
 		First(&player).Error; err != nil {
-		http.Error(w, "Player not found", http.StatusNotFound)
+		WriteProblem(w, r, api.NotFound("Player not found"))
 		return
 	}
 
@@ -272,7 +253,7 @@ func (s *Server) getPlayerFight(w http.ResponseWriter, r *http.Request, playerID
 		Pluck("id", &heroIDs)
 
 	if len(heroIDs) == 0 {
-		http.Error(w, "Fight not found", http.StatusNotFound)
+		WriteProblem(w, r, api.NotFound("Fight not found"))
 		return
 	}
 
@@ -286,16 +267,16 @@ func (s *Server) getPlayerFight(w http.ResponseWriter, r *http.Request, playerID
 
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Fight not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Fight not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to get fight: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to get fight: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(fight)
+	json.NewEncoder(w).Encode(api.NewFight(fight))
 }
 
 func (s *Server) getHeroFight(w http.ResponseWriter, r *http.Request, heroID, fightID uuid.UUID) {
@@ -304,7 +285,7 @@ func (s *Server) getHeroFight(w http.ResponseWriter, r *http.Request, heroID, fi
 	if err := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
 		Where("id = ? AND deleted_at IS NULL", heroID).
 		First(&hero).Error; err != nil {
-		http.Error(w, "Hero not found", http.StatusNotFound)
+		WriteProblem(w, r, api.NotFound("Hero not found"))
 		return
 	}
 
@@ -318,29 +299,23 @@ func (s *Server) getHeroFight(w http.ResponseWriter, r *http.Request, heroID, fi
 
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Fight not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Fight not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to get fight: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to get fight: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(fight)
-}
-
-type FightResult struct {
-	Fight   database.Fight `json:"fight"`
-	Victory bool           `json:"victory"`
-	EloGain int32          `json:"elo_gain"`
+	json.NewEncoder(w).Encode(api.NewFight(fight))
 }
 
 func (s *Server) createHeroFight(w http.ResponseWriter, r *http.Request, attackerID uuid.UUID) {
 	// Read body to buffer so we can use it multiple times
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Failed to read request body"))
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -354,7 +329,7 @@ func (s *Server) createHeroFight(w http.ResponseWriter, r *http.Request, attacke
 		if err := json.Unmarshal(bodyBytes, &secretStruct); err == nil && secretStruct.Secret != "" {
 			secret, err = uuid.Parse(secretStruct.Secret)
 			if err != nil {
-				http.Error(w, "Invalid player _secret", http.StatusBadRequest)
+				WriteProblem(w, r, api.InvalidRequest("Invalid player _secret"))
 				return
 			}
 		}
@@ -365,7 +340,7 @@ func (s *Server) createHeroFight(w http.ResponseWriter, r *http.Request, attacke
 		var cookieErr error
 		secret, cookieErr = s.extractSecretFromCookie(r)
 		if cookieErr != nil {
-			http.Error(w, "Player secret required (provide _secret in body or login)", http.StatusUnauthorized)
+			WriteProblem(w, r, api.Unauthorized("Player secret required (provide _secret in body or login)"))
 			return
 		}
 	}
@@ -377,30 +352,44 @@ func (s *Server) createHeroFight(w http.ResponseWriter, r *http.Request, attacke
 		Preload("Player").
 		First(&attacker).Error
 	if err != nil {
-		http.Error(w, "Hero not found", http.StatusNotFound)
+		WriteProblem(w, r, api.NotFound("Hero not found"))
 		return
 	}
 
 	// Verify the player owns this hero via secret
 	if attacker.Player == nil || attacker.Player.Secret != secret {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		WriteProblem(w, r, api.Unauthorized("Unauthorized"))
 		return
 	}
 
+	// The fight runs to completion even if the client disconnects or the server drains,
+	// the judge may already have answered and the outcome must be committed.
+	if !s.tasks.start() {
+		WriteProblem(w, r, api.Unavailable("Server is shutting down"))
+		return
+	}
+	defer s.tasks.done()
+	fightCtx := context.WithoutCancel(r.Context())
+
 	// Find a suitable opponent with similar ELO
-	defender, err := s.findOpponent(r.Context(), attacker)
+	ctx, span := tracer.Start(fightCtx, "fight.findOpponent")
+	defender, err := s.findOpponent(ctx, attacker)
+	tracing.RecordError(span, err)
+	span.End()
 	if err != nil {
-		logger.Sugar().Errorf("Failed to find opponent: %v", err)
-		http.Error(w, "No suitable opponent found", http.StatusNotFound)
+		logger.Ctx(r.Context()).Errorf("Failed to find opponent: %v", err)
+		WriteProblem(w, r, api.NotFound("No suitable opponent found"))
 		return
 	}
 
 	// Generate combat narrative using Claude API
-	narrative, outcome, err := s.claude.GenerateCombatNarrative(r.Context(), attacker, defender)
+	narrative, outcome, err := s.judge.GenerateCombatNarrative(fightCtx, attacker, defender)
+	judge := metrics.JudgeClaude
 
 	// Fallback to random outcome if Claude fails
 	if err != nil {
-		logger.Sugar().Warnf("Failed to generate narrative via Claude: %v, falling back to random", err)
+		judge = metrics.JudgeFallback
+		logger.Ctx(r.Context()).Warnf("Failed to generate narrative via Claude: %v, falling back to random", err)
 		narrative = fmt.Sprintf("In a clash of creativity, %s faced %s in a battle beyond logic.", attacker.Title, defender.Title)
 
 		// Pure chaos fallback - random outcome
@@ -432,13 +421,16 @@ func (s *Server) createHeroFight(w http.ResponseWriter, r *http.Request, attacke
 	}
 
 	// Start transaction to update ELOs and create fight
-	tx := s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).Begin()
+	ctx, span = tracer.Start(fightCtx, "fight.transaction")
+	tx := s.db.DB.Clauses(dbresolver.Write).WithContext(ctx).Begin()
 
 	// Create fight record
 	if err := tx.Create(&fight).Error; err != nil {
 		tx.Rollback()
-		logger.Sugar().Errorf("Failed to create fight: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		tracing.RecordError(span, err)
+		span.End()
+		logger.Ctx(r.Context()).Errorf("Failed to create fight: %v", err)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
@@ -458,8 +450,10 @@ func (s *Server) createHeroFight(w http.ResponseWriter, r *http.Request, attacke
 	if err := tx.Model(&database.Hero{}).Where("id = ?", attackerID).
 		Update("elo", newAttackerElo).Error; err != nil {
 		tx.Rollback()
-		logger.Sugar().Errorf("Failed to update attacker ELO: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		tracing.RecordError(span, err)
+		span.End()
+		logger.Ctx(r.Context()).Errorf("Failed to update attacker ELO: %v", err)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
@@ -481,28 +475,34 @@ func (s *Server) createHeroFight(w http.ResponseWriter, r *http.Request, attacke
 	if err := tx.Model(&database.Hero{}).Where("id = ?", defender.ID).
 		Update("elo", newDefenderElo).Error; err != nil {
 		tx.Rollback()
-		logger.Sugar().Errorf("Failed to update defender ELO: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		tracing.RecordError(span, err)
+		span.End()
+		logger.Ctx(r.Context()).Errorf("Failed to update defender ELO: %v", err)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
-		logger.Sugar().Errorf("Failed to commit transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		tracing.RecordError(span, err)
+		span.End()
+		logger.Ctx(r.Context()).Errorf("Failed to commit transaction: %v", err)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
+	span.End()
+	metrics.FightOutcomes.WithLabelValues(judge, outcome.String()).Inc()
 
 	// Load the complete fight with relationships
-	s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
+	s.db.DB.Clauses(dbresolver.Read).WithContext(fightCtx).
 		Where("id = ?", fight.ID).
 		Preload("Attacker").
 		Preload("Defender").
 		First(&fight)
 
 	// Prepare response
-	result := FightResult{
-		Fight:   fight,
+	result := api.FightResult{
+		Fight:   api.NewFight(fight),
 		Victory: outcome == database.FightOutcome_Victory,
 		EloGain: eloGain,
 	}
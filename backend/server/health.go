@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/claude"
+	"github.com/expki/backend/pixel-protocol/config"
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/expki/backend/pixel-protocol/logger"
+)
+
+// Health serves the liveness, readiness and version probes
+type Health struct {
+	db       *database.Database
+	tls      *config.ConfigTLS
+	judge    *claude.Client // nil unless the judge is part of readiness
+	version  atomic.Pointer[api.Version]
+	draining atomic.Bool
+}
+
+// NewHealth creates the probes, the judge is only checked when the config asks for it
+func NewHealth(cfg *config.Config, db *database.Database, claudeClient *claude.Client) *Health {
+	h := &Health{
+		db:  db,
+		tls: &cfg.TLS,
+	}
+	h.SetConfig(cfg)
+	if cfg.Claude.CheckReady {
+		h.judge = claudeClient
+	}
+	return h
+}
+
+// SetConfig updates the config fingerprint after a reload
+func (h *Health) SetConfig(cfg *config.Config) {
+	version := buildVersion(cfg)
+	h.version.Store(&version)
+}
+
+// SetDraining fails readiness so load balancers stop routing new requests during shutdown
+func (h *Health) SetDraining() {
+	h.draining.Store(true)
+}
+
+// HandleHealthz reports that the process is alive, it never checks dependencies
+func (h *Health) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok\n"))
+}
+
+// HandleReadyz reports whether the server can take traffic
+func (h *Health) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	readiness := api.Readiness{Ready: true, Checks: map[string]api.Check{}}
+	check := func(name string, err error) {
+		if err == nil {
+			readiness.Checks[name] = api.Check{Status: api.CheckOK}
+			return
+		}
+		// the cause stays in the log, it names hosts and connection strings
+		readiness.Ready = false
+		readiness.Checks[name] = api.Check{Status: api.CheckFailed}
+		logger.Ctx(ctx).Warnf("readiness check %s failed: %v", name, err)
+	}
+	if h.draining.Load() {
+		readiness.Ready = false
+		readiness.Checks["shutdown"] = api.Check{Status: api.CheckDraining}
+	}
+	check("database", h.db.Ping(ctx))
+	check("tls", h.tls.Ready())
+	if h.judge != nil {
+		check("judge", h.judge.Ping(ctx))
+	}
+
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(readiness)
+}
+
+// HandleVersion reports the build commit and the fingerprint of the loaded config
+func (h *Health) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(h.version.Load())
+}
+
+// buildVersion reads the vcs stamp of the binary, the fingerprint changes with any config value but the secrets
+func buildVersion(cfg *config.Config) api.Version {
+	version := api.Version{Commit: "unknown", GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				version.Commit = setting.Value
+			case "vcs.time":
+				version.CommitTime = setting.Value
+			case "vcs.modified":
+				version.Modified = setting.Value == "true"
+			}
+		}
+	}
+	raw, err := json.Marshal(cfg.Redacted())
+	if err != nil {
+		logger.Sugar().Errorf("could not fingerprint config: %v", err)
+		return version
+	}
+	sum := sha256.Sum256(raw)
+	version.ConfigFingerprint = "sha256:" + hex.EncodeToString(sum[:])
+	return version
+}
@@ -5,9 +5,9 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/expki/backend/pixel-protocol/api"
 	"github.com/expki/backend/pixel-protocol/database"
 	"github.com/expki/backend/pixel-protocol/geolookup"
 	"github.com/expki/backend/pixel-protocol/logger"
@@ -25,14 +25,12 @@ type HeroUpdateRequest struct {
 	Description *string `json:"description,omitempty"`
 }
 
+// HandleHero handles POST /api/hero and GET, PUT, PATCH, DELETE /api/hero/{id}
 func (s *Server) HandleHero(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/api/hero")
-	segments := strings.Split(strings.Trim(path, "/"), "/")
-
 	// Read body to buffer so we can use it multiple times
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Failed to read request body"))
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -46,7 +44,7 @@ func (s *Server) HandleHero(w http.ResponseWriter, r *http.Request) {
 		if err := json.Unmarshal(bodyBytes, &secretStruct); err == nil && secretStruct.Secret != "" {
 			secret, err = uuid.Parse(secretStruct.Secret)
 			if err != nil {
-				http.Error(w, "Invalid player _secret", http.StatusBadRequest)
+				WriteProblem(w, r, api.InvalidRequest("Invalid player _secret"))
 				return
 			}
 		}
@@ -57,7 +55,7 @@ func (s *Server) HandleHero(w http.ResponseWriter, r *http.Request) {
 		var cookieErr error
 		secret, cookieErr = s.extractSecretFromCookie(r)
 		if cookieErr != nil {
-			http.Error(w, "Player secret required (provide _secret in body or login)", http.StatusUnauthorized)
+			WriteProblem(w, r, api.Unauthorized("Player secret required (provide _secret in body or login)"))
 			return
 		}
 	}
@@ -67,10 +65,10 @@ func (s *Server) HandleHero(w http.ResponseWriter, r *http.Request) {
 	result := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).Where("secret = ? AND deleted_at IS NULL", secret).First(&player)
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Player not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Player not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to get player: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to get player: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
@@ -82,9 +80,9 @@ func (s *Server) HandleHero(w http.ResponseWriter, r *http.Request) {
 		s.createHero(w, r, player)
 		return
 	}
-	id, err := uuid.Parse(segments[0])
+	id, err := uuid.Parse(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, "Invalid Hero ID", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Invalid Hero ID"))
 		return
 	}
 
@@ -98,7 +96,7 @@ func (s *Server) HandleHero(w http.ResponseWriter, r *http.Request) {
 	case http.MethodDelete:
 		s.deleteHero(w, r, player, id)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		WriteProblem(w, r, api.MethodNotAllowed("Method not allowed"))
 	}
 }
 
@@ -110,28 +108,28 @@ func (s *Server) getHero(w http.ResponseWriter, r *http.Request, player database
 		First(&hero)
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Hero not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Hero not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to get hero: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to get hero: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(hero)
+	json.NewEncoder(w).Encode(api.NewHero(hero))
 }
 
 func (s *Server) createHero(w http.ResponseWriter, r *http.Request, player database.Player) {
 	var req HeroRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Invalid request body"))
 		return
 	}
 
 	// Validate required fields
 	if req.Title == "" || req.Description == "" {
-		http.Error(w, "Title and Description are required", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Title and Description are required"))
 		return
 	}
 
@@ -147,8 +145,8 @@ func (s *Server) createHero(w http.ResponseWriter, r *http.Request, player datab
 
 	result := s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).Create(&hero)
 	if result.Error != nil {
-		logger.Sugar().Errorf("Failed to create hero: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Ctx(r.Context()).Errorf("Failed to create hero: %v", result.Error)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
@@ -158,20 +156,20 @@ func (s *Server) createHero(w http.ResponseWriter, r *http.Request, player datab
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(hero)
+	json.NewEncoder(w).Encode(api.NewHero(hero))
 }
 
 func (s *Server) updateHero(w http.ResponseWriter, r *http.Request, player database.Player, id uuid.UUID) {
 
 	var req HeroRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Invalid request body"))
 		return
 	}
 
 	// Validate required fields
 	if req.Title == "" || req.Description == "" {
-		http.Error(w, "Country, title, and description are required", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Country, title, and description are required"))
 		return
 	}
 
@@ -181,10 +179,10 @@ func (s *Server) updateHero(w http.ResponseWriter, r *http.Request, player datab
 		Where("player_id = ? AND id = ? AND deleted_at IS NULL", player.ID, id).First(&hero)
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Hero not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Hero not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to find hero: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to find hero: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
@@ -196,20 +194,20 @@ func (s *Server) updateHero(w http.ResponseWriter, r *http.Request, player datab
 
 	result = s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).Save(&hero)
 	if result.Error != nil {
-		logger.Sugar().Errorf("Failed to update hero: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Ctx(r.Context()).Errorf("Failed to update hero: %v", result.Error)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(hero)
+	json.NewEncoder(w).Encode(api.NewHero(hero))
 }
 
 func (s *Server) patchHero(w http.ResponseWriter, r *http.Request, player database.Player, id uuid.UUID) {
 
 	var req HeroUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Invalid request body"))
 		return
 	}
 
@@ -219,10 +217,10 @@ func (s *Server) patchHero(w http.ResponseWriter, r *http.Request, player databa
 		Where("player_id =? AND id = ? AND deleted_at IS NULL", player.ID, id).First(&hero)
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Hero not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Hero not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to find hero: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to find hero: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
@@ -238,13 +236,13 @@ func (s *Server) patchHero(w http.ResponseWriter, r *http.Request, player databa
 
 	result = s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).Save(&hero)
 	if result.Error != nil {
-		logger.Sugar().Errorf("Failed to patch hero: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Ctx(r.Context()).Errorf("Failed to patch hero: %v", result.Error)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(hero)
+	json.NewEncoder(w).Encode(api.NewHero(hero))
 }
 
 func (s *Server) deleteHero(w http.ResponseWriter, r *http.Request, player database.Player, id uuid.UUID) {
@@ -257,13 +255,13 @@ func (s *Server) deleteHero(w http.ResponseWriter, r *http.Request, player datab
 		Update("deleted_at", now)
 
 	if result.Error != nil {
-		logger.Sugar().Errorf("Failed to delete hero: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Ctx(r.Context()).Errorf("Failed to delete hero: %v", result.Error)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Hero not found or already deleted", http.StatusNotFound)
+		WriteProblem(w, r, api.NotFound("Hero not found or already deleted"))
 		return
 	}
 
@@ -1,39 +1,40 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 
+	"github.com/expki/backend/pixel-protocol/api"
 	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/expki/backend/pixel-protocol/imagestore"
 	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/expki/backend/pixel-protocol/metrics"
+	"github.com/expki/backend/pixel-protocol/pixelart"
 	"github.com/google/uuid"
 	"gorm.io/plugin/dbresolver"
 )
 
-// HandleHeroImage handles /api/hero/:id/image
+// HandleHeroImage handles GET and PUT /api/hero/{id}/image
 func (s *Server) HandleHeroImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Extract hero ID from path
-	path := strings.TrimPrefix(r.URL.Path, "/api/hero/")
-	segments := strings.Split(path, "/")
-	
-	if len(segments) < 2 || segments[1] != "image" {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+	heroID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid hero ID"))
 		return
 	}
 
-	heroID, err := uuid.Parse(segments[0])
-	if err != nil {
-		http.Error(w, "Invalid hero ID", http.StatusBadRequest)
+	// Upload a custom portrait
+	if r.Method == http.MethodPut {
+		s.uploadHeroPortrait(w, r, heroID)
 		return
 	}
 
@@ -44,78 +45,66 @@ func (s *Server) HandleHeroImage(w http.ResponseWriter, r *http.Request) {
 		First(&hero).Error
 	
 	if err != nil {
-		http.Error(w, "Hero not found", http.StatusNotFound)
+		WriteProblem(w, r, api.NotFound("Hero not found"))
 		return
 	}
 
-	// Generate image from third-party API
-	imageData, err := s.getHeroImage(hero)
-	if err != nil {
-		logger.Sugar().Errorf("Failed to get hero image: %v", err)
-		// Return a default placeholder image on error
-		s.serveDefaultImage(w)
+	// Parse requested size
+	size := 256
+	if sizeStr := r.URL.Query().Get("size"); sizeStr != "" {
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil || size < pixelart.MinSize || size > pixelart.MaxSize {
+			WriteProblem(w, r, api.InvalidRequest(fmt.Sprintf("Invalid size, must be between %d and %d", pixelart.MinSize, pixelart.MaxSize)))
+			return
+		}
+	}
+
+	// Serve the approved portrait if the owner uploaded one
+	stored, err := s.getApprovedPortrait(r.Context(), hero.ID)
+	if err == nil {
+		s.serveScaledImage(w, r, stored, size, pixelart.Scale, "public, max-age=3600") // Cache for 1 hour
 		return
+	} else if !errors.Is(err, imagestore.ErrNotFound) {
+		logger.Ctx(r.Context()).Errorf("Failed to get hero portrait, falling back to avatar: %v", err)
+		metrics.ImageFailures.WithLabelValues(metrics.ImagePortrait).Inc()
 	}
 
-	// Set proper headers for PNG image
-	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
-	w.Header().Set("ETag", generateETag(hero))
-	
-	// Check if client has cached version
-	if match := r.Header.Get("If-None-Match"); match == generateETag(hero) {
-		w.WriteHeader(http.StatusNotModified)
+	// Serve from the image store, generating the avatar on first request
+	stored, err = s.getHeroAvatar(r.Context(), hero)
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to get hero image: %v", err)
+		metrics.ImageFailures.WithLabelValues(metrics.ImageAvatar).Inc()
+		// Return a default placeholder image on error
+		s.serveDefaultImage(w)
 		return
 	}
 
-	// Write image data
-	w.Write(imageData)
+	s.serveScaledImage(w, r, stored, size, pixelart.Enlarge, "public, max-age=3600") // Cache for 1 hour
 }
 
-func (s *Server) getHeroImage(hero database.Hero) ([]byte, error) {
-	// Using RoboHash as an example third-party API for generating unique avatars
-	// You can replace this with any other image generation API
-	
-	// Create a unique seed based on hero properties
-	seed := fmt.Sprintf("%s-%s-%s-%d", hero.ID, hero.Title, hero.Country, hero.Elo)
-	
-	// Generate hash for consistent image generation
-	hasher := md5.New()
-	hasher.Write([]byte(seed))
-	hash := hex.EncodeToString(hasher.Sum(nil))
-	
-	// Construct API URL - using RoboHash as example
-	// RoboHash generates unique robot avatars based on any text input
-	apiURL := fmt.Sprintf("https://robohash.org/%s.png?size=256x256&set=set1", hash)
-	
-	// For production, you might want to use a different API like:
-	// - DiceBear Avatars: https://avatars.dicebear.com/
-	// - Adorable Avatars: http://avatars.adorable.io/
-	// - UI Avatars: https://ui-avatars.com/
-	// - Or a custom AI image generation service
-	
-	// Make HTTP request to third-party API
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// getHeroAvatar returns the sprite grid of the hero, one pixel per cell, which is enlarged per request.
+// The grid only depends on properties that identify the hero, so it is stable across restarts and elo changes.
+// Grids of earlier titles or countries are removed once the current one is stored.
+func (s *Server) getHeroAvatar(ctx context.Context, hero database.Hero) (imagestore.Image, error) {
+	key := imagestore.Key{
+		Owner:   imagestore.OwnerHero,
+		ID:      hero.ID,
+		Variant: "avatar-" + avatarDigest(hero),
 	}
-	
-	resp, err := client.Get(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch image from API: %w", err)
+	stored, err := s.images.Lookup(ctx, key)
+	if !errors.Is(err, imagestore.ErrNotFound) {
+		return stored, err
 	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	imageData, err := pixelart.EncodePNG(pixelart.New(hero.ID.String(), hero.Title, hero.Country).Grid())
+	if err != nil {
+		return imagestore.Image{}, err
 	}
-	
-	// Read the image data
-	imageData, err := io.ReadAll(resp.Body)
+	stored, err = s.images.Put(ctx, key, "image/png", imageData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read image data: %w", err)
+		return imagestore.Image{}, err
 	}
-	
-	return imageData, nil
+	s.pruneVariants(ctx, key, "avatar-")
+	return stored, nil
 }
 
 func (s *Server) serveDefaultImage(w http.ResponseWriter) {
@@ -138,147 +127,137 @@ func (s *Server) serveDefaultImage(w http.ResponseWriter) {
 	w.Write(transparentPNG)
 }
 
-// HandleFightImage handles /api/hero/:id/fight/:fightId/image
+// HandleFightImage handles GET and POST /api/hero/{id}/fight/{fightId}/image
 func (s *Server) HandleFightImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	heroID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid hero ID"))
 		return
 	}
 
-	// Extract hero ID and fight ID from path
-	path := strings.TrimPrefix(r.URL.Path, "/api/hero/")
-	segments := strings.Split(path, "/")
-	
-	if len(segments) < 4 || segments[1] != "fight" || segments[3] != "image" {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+	fightID, err := uuid.Parse(r.PathValue("fightId"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid fight ID"))
 		return
 	}
 
-	heroID, err := uuid.Parse(segments[0])
+	// Get fight details from database
+	var fight database.Fight
+	err = s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
+		Where("id = ? AND (attacker_id = ? OR defender_id = ?)", fightID, heroID, heroID).
+		Preload("Attacker").
+		Preload("Defender").
+		First(&fight).Error
+
 	if err != nil {
-		http.Error(w, "Invalid hero ID", http.StatusBadRequest)
+		WriteProblem(w, r, api.NotFound("Fight not found"))
 		return
 	}
 
-	fightID, err := uuid.Parse(segments[2])
-	if err != nil {
-		http.Error(w, "Invalid fight ID", http.StatusBadRequest)
+	// The one card of the fight, replaced by every upload
+	cardKey := imagestore.Key{Owner: imagestore.OwnerFight, ID: fight.ID, Variant: "card"}
+
+	if r.Method == http.MethodGet {
+		stored, err := s.images.Lookup(r.Context(), cardKey)
+		if errors.Is(err, imagestore.ErrNotFound) {
+			WriteProblem(w, r, api.NotFound("Fight image not found"))
+			return
+		} else if err != nil {
+			logger.Ctx(r.Context()).Errorf("Failed to lookup fight image: %v", err)
+			metrics.ImageFailures.WithLabelValues(metrics.ImageCard).Inc()
+			WriteProblem(w, r, api.Internal())
+			return
+		}
+		s.serveStoredImage(w, r, stored, "public, max-age=300")
 		return
 	}
 
 	// Parse multipart form to get the uploaded image
-	err = r.ParseMultipartForm(32 << 20) // 32 MB limit
+	r.Body = http.MaxBytesReader(w, r.Body, 8<<20)
+	err = r.ParseMultipartForm(8 << 20) // 8 MB limit
 	if err != nil {
-		http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Failed to parse multipart form"))
 		return
 	}
 
-	// Get the uploaded file
-	file, fileHeader, err := r.FormFile("image")
+	// Only the owner of the hero in the path may replace the card
+	secret, err := s.formSecret(r)
 	if err != nil {
-		http.Error(w, "No image file provided", http.StatusBadRequest)
+		WriteProblem(w, r, err)
+		return
+	}
+	hero := fight.Attacker
+	if fight.DefenderID == heroID {
+		hero = fight.Defender
+	}
+	var player database.Player
+	if hero != nil {
+		err = s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
+			Where("id = ?", hero.PlayerID).
+			First(&player).Error
+	}
+	if hero == nil || err != nil || player.Secret != secret {
+		WriteProblem(w, r, api.Unauthorized("Unauthorized"))
 		return
 	}
-	defer file.Close()
 
-	// Validate file type
-	contentType := fileHeader.Header.Get("Content-Type")
-	if !strings.HasPrefix(contentType, "image/") {
-		http.Error(w, "File must be an image", http.StatusBadRequest)
+	// Get the uploaded file
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("No image file provided"))
 		return
 	}
+	defer file.Close()
 
 	// Read the uploaded image data
 	uploadedImageData, err := io.ReadAll(file)
 	if err != nil {
-		http.Error(w, "Failed to read uploaded image", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Failed to read uploaded image"))
 		return
 	}
 
-	// Get fight details from database
-	var fight database.Fight
-	err = s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
-		Where("id = ? AND (attacker_id = ? OR defender_id = ?)", fightID, heroID, heroID).
-		Preload("Attacker").
-		Preload("Defender").
-		First(&fight).Error
-	
+	// Validate file type by its content, the client supplied content type is not trusted.
+	// The card is small, larger uploads are refused before they are decoded.
+	uploadedImage, _, err := pixelart.DecodeUpload(uploadedImageData, pixelart.MaxCardUploadPixels)
 	if err != nil {
-		http.Error(w, "Fight not found", http.StatusNotFound)
+		WriteProblem(w, r, api.InvalidRequest(fmt.Sprintf("Invalid image: %v", err)))
 		return
 	}
 
-	// Generate fight result image from third-party API
-	imageData, err := s.getFightImage(fight, uploadedImageData)
+	// Replace the card, the store removes the previous one
+	imageData, err := s.getFightImage(fight, uploadedImage)
+	var stored imagestore.Image
+	if err == nil {
+		stored, err = s.images.Put(r.Context(), cardKey, "image/png", imageData)
+	}
 	if err != nil {
-		logger.Sugar().Errorf("Failed to get fight image: %v", err)
+		logger.Ctx(r.Context()).Errorf("Failed to get fight image: %v", err)
+		metrics.ImageFailures.WithLabelValues(metrics.ImageCard).Inc()
 		// Return a default placeholder image on error
 		s.serveFightDefaultImage(w)
 		return
 	}
+	s.pruneVariants(r.Context(), cardKey, "card-")
 
-	// Set proper headers for PNG image
-	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable") // Cache for 1 year (infinite)
-	w.Header().Set("ETag", generateFightETag(fight))
-	
-	// Write image data
-	w.Write(imageData)
+	s.serveStoredImage(w, r, stored, "public, max-age=300")
 }
 
-func (s *Server) getFightImage(fight database.Fight, uploadedImageData []byte) ([]byte, error) {
-	// Create a unique seed based on fight properties
-	seed := fmt.Sprintf("%s-%s-%s-%d-%s", 
-		fight.ID, 
-		fight.Attacker.Title, 
-		fight.Defender.Title, 
-		fight.Outcome,
-		fight.Transcript[:min(50, len(fight.Transcript))]) // First 50 chars of transcript
-	
-	// Generate hash for consistent image generation
-	hasher := md5.New()
-	hasher.Write([]byte(seed))
-	hasher.Write(uploadedImageData) // Include uploaded image data in hash
-	hash := hex.EncodeToString(hasher.Sum(nil))
-	
-	// Using RoboHash as example - you could use different sets based on fight outcome
-	var setParam string
-	switch fight.Outcome {
-	case database.FightOutcome_Victory:
-		setParam = "set1" // Robots for victory
-	case database.FightOutcome_Defeat:
-		setParam = "set2" // Monsters for defeat  
-	case database.FightOutcome_Draw:
-		setParam = "set3" // Kittens for draw (because why not)
-	default:
-		setParam = "set1"
+func (s *Server) getFightImage(fight database.Fight, uploadedImage image.Image) ([]byte, error) {
+	if fight.Attacker == nil || fight.Defender == nil {
+		return nil, fmt.Errorf("fight %s is missing its heroes", fight.ID)
 	}
-	
-	// Construct API URL with fight-specific parameters
-	apiURL := fmt.Sprintf("https://robohash.org/%s.png?size=512x512&set=%s", hash, setParam)
-	
-	// Make HTTP request to third-party API
-	client := &http.Client{
-		Timeout: 15 * time.Second,
-	}
-	
-	resp, err := client.Get(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch fight image from API: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fight image API returned status %d", resp.StatusCode)
-	}
-	
-	// Read the image data
-	imageData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read fight image data: %w", err)
+
+	// Compose a shareable card with both avatars, the uploaded image and the outcome
+	card := pixelart.Card{
+		Upload:       uploadedImage,
+		Attacker:     pixelart.New(fight.Attacker.ID.String(), fight.Attacker.Title, fight.Attacker.Country),
+		Defender:     pixelart.New(fight.Defender.ID.String(), fight.Defender.Title, fight.Defender.Country),
+		AttackerName: fight.Attacker.Title,
+		DefenderName: fight.Defender.Title,
+		Winner:       fightWinner(fight),
+		Transcript:   fight.Transcript,
 	}
-	
-	return imageData, nil
+	return card.PNG()
 }
 
 func (s *Server) serveFightDefaultImage(w http.ResponseWriter) {
@@ -300,27 +279,79 @@ func (s *Server) serveFightDefaultImage(w http.ResponseWriter) {
 	w.Write(transparentPNG)
 }
 
-func generateETag(hero database.Hero) string {
-	// Generate ETag based on hero properties that affect the image
-	data := fmt.Sprintf("%s-%s-%s-%d", 
-		hero.ID, hero.Title, hero.Country, hero.Elo)
-	hasher := md5.New()
-	hasher.Write([]byte(data))
-	return fmt.Sprintf(`"%s"`, hex.EncodeToString(hasher.Sum(nil)))
+// serveStoredImage streams an image from the store, handling conditional and range requests
+func (s *Server) serveStoredImage(w http.ResponseWriter, r *http.Request, stored imagestore.Image, cacheControl string) {
+	content, opened, err := s.images.Open(r.Context(), stored.Hash)
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to open stored image %s: %v", stored.Hash, err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+	defer content.Close()
+
+	contentType := stored.ContentType
+	if contentType == "" {
+		contentType = opened.ContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", stored.ETag())
+	http.ServeContent(w, r, "", opened.ModTime, content)
 }
 
-func generateFightETag(fight database.Fight) string {
-	// Generate ETag based on fight properties that affect the image
-	data := fmt.Sprintf("%s-%s-%s-%d-%s", 
-		fight.ID, fight.Attacker.Title, fight.Defender.Title, fight.Outcome, fight.Transcript)
-	hasher := md5.New()
-	hasher.Write([]byte(data))
-	return fmt.Sprintf(`"%s"`, hex.EncodeToString(hasher.Sum(nil)))
+// serveScaledImage serves a stored pixel-art image scaled in memory, so only one size is ever stored
+func (s *Server) serveScaledImage(w http.ResponseWriter, r *http.Request, stored imagestore.Image, size int, scale func(*image.Paletted, int) *image.Paletted, cacheControl string) {
+	content, opened, err := s.images.Open(r.Context(), stored.Hash)
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to open stored image %s: %v", stored.Hash, err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+	defer content.Close()
+	decoded, err := png.Decode(content)
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to decode stored image %s: %v", stored.Hash, err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+	paletted, ok := decoded.(*image.Paletted)
+	if !ok {
+		paletted = pixelart.Pixelate(decoded)
+	}
+	imageData, err := pixelart.EncodePNG(scale(paletted, size))
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to encode scaled image %s: %v", stored.Hash, err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%d"`, stored.Hash, size))
+	http.ServeContent(w, r, "", opened.ModTime, bytes.NewReader(imageData))
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// pruneVariants removes the variants of the key's owner with the prefix that the key replaced
+func (s *Server) pruneVariants(ctx context.Context, key imagestore.Key, prefix string) {
+	variants, err := s.images.Variants(ctx, key.Owner, key.ID)
+	if err != nil {
+		logger.Ctx(ctx).Warnf("Failed to list images of %s %s: %v", key.Owner, key.ID, err)
+		return
+	}
+	for _, variant := range variants {
+		if !strings.HasPrefix(variant, prefix) || variant == key.Variant {
+			continue
+		}
+		err = s.images.Delete(ctx, imagestore.Key{Owner: key.Owner, ID: key.ID, Variant: variant})
+		if err != nil {
+			logger.Ctx(ctx).Warnf("Failed to remove replaced image %s/%s/%s: %v", key.Owner, key.ID, variant, err)
+		}
 	}
-	return b
-}
\ No newline at end of file
+}
+
+// avatarDigest identifies the hero properties that affect the avatar
+func avatarDigest(hero database.Hero) string {
+	hasher := md5.New()
+	hasher.Write([]byte(fmt.Sprintf("%s-%s-%s", hero.ID, hero.Title, hero.Country)))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -6,9 +6,9 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/expki/backend/pixel-protocol/api"
 	"github.com/expki/backend/pixel-protocol/database"
 	"github.com/expki/backend/pixel-protocol/logger"
 	"github.com/google/uuid"
@@ -23,35 +23,23 @@ type PlayerUpdateRequest struct {
 	UserName *string `json:"username,omitempty"`
 }
 
+// HandlePlayer handles POST /api/player and GET, PUT, PATCH, DELETE /api/player/{id}
 func (s *Server) HandlePlayer(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/api/player")
-	segments := strings.Split(strings.Trim(path, "/"), "/")
 	if r.Method == http.MethodPost {
 		s.createPlayer(w, r)
 		return
 	}
-	
-	if len(segments) == 0 || segments[0] == "" {
-		http.Error(w, "Player ID is required", http.StatusBadRequest)
-		return
-	}
-	
-	id, err := uuid.Parse(segments[0])
-	if err != nil {
-		http.Error(w, "Invalid player ID", http.StatusBadRequest)
-		return
-	}
 
-	// Check if this is a heroes endpoint
-	if len(segments) > 1 && segments[1] == "heroes" {
-		s.getPlayerHeroes(w, r, id)
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid player ID"))
 		return
 	}
 
 	// Read body to buffer so we can use it multiple times
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Failed to read request body"))
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -65,7 +53,7 @@ func (s *Server) HandlePlayer(w http.ResponseWriter, r *http.Request) {
 		if err := json.Unmarshal(bodyBytes, &secretStruct); err == nil && secretStruct.Secret != "" {
 			secret, err = uuid.Parse(secretStruct.Secret)
 			if err != nil {
-				http.Error(w, "Invalid player _secret", http.StatusBadRequest)
+				WriteProblem(w, r, api.InvalidRequest("Invalid player _secret"))
 				return
 			}
 		}
@@ -76,7 +64,7 @@ func (s *Server) HandlePlayer(w http.ResponseWriter, r *http.Request) {
 		var cookieErr error
 		secret, cookieErr = s.extractSecretFromCookie(r)
 		if cookieErr != nil {
-			http.Error(w, "Player secret required (provide _secret in body or login)", http.StatusUnauthorized)
+			WriteProblem(w, r, api.Unauthorized("Player secret required (provide _secret in body or login)"))
 			return
 		}
 	}
@@ -94,7 +82,7 @@ func (s *Server) HandlePlayer(w http.ResponseWriter, r *http.Request) {
 	case http.MethodDelete:
 		s.deletePlayer(w, r, id, secret)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		WriteProblem(w, r, api.MethodNotAllowed("Method not allowed"))
 	}
 }
 
@@ -104,27 +92,27 @@ func (s *Server) getPlayer(w http.ResponseWriter, r *http.Request, id, secret uu
 	result := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).Where("id = ? AND secret = ? AND deleted_at IS NULL", id, secret).First(&player)
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Player not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Player not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to get player: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to get player: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(player)
+	json.NewEncoder(w).Encode(api.NewPlayer(player))
 }
 
 func (s *Server) createPlayer(w http.ResponseWriter, r *http.Request) {
 	var req PlayerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Invalid request body"))
 		return
 	}
 
 	if req.UserName == "" {
-		http.Error(w, "Username is required", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Username is required"))
 		return
 	}
 
@@ -139,9 +127,12 @@ func (s *Server) createPlayer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result := s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).Create(&player)
-	if result.Error != nil {
-		logger.Sugar().Errorf("Failed to create player: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if database.IsUniqueViolation(result.Error) {
+		WriteProblem(w, r, api.Conflict("Username is taken, please retry"))
+		return
+	} else if result.Error != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to create player: %v", result.Error)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
@@ -151,7 +142,7 @@ func (s *Server) createPlayer(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(player)
+	json.NewEncoder(w).Encode(api.NewPlayer(player))
 }
 
 func (s *Server) generateUserNameSuffix(ctx context.Context, username string) uint32 {
@@ -186,12 +177,12 @@ func (s *Server) updatePlayer(w http.ResponseWriter, r *http.Request, id, secret
 
 	var req PlayerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Invalid request body"))
 		return
 	}
 
 	if req.UserName == "" {
-		http.Error(w, "Username is required", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Username is required"))
 		return
 	}
 
@@ -199,10 +190,10 @@ func (s *Server) updatePlayer(w http.ResponseWriter, r *http.Request, id, secret
 	result := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).Where("id = ? AND secret = ? AND deleted_at IS NULL", id, secret).First(&player)
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Player not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Player not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to find player: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to find player: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
@@ -215,25 +206,25 @@ func (s *Server) updatePlayer(w http.ResponseWriter, r *http.Request, id, secret
 
 	result = s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).Save(&player)
 	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "duplicate") || strings.Contains(result.Error.Error(), "unique") {
-			http.Error(w, "Unable to update with unique username", http.StatusConflict)
+		if database.IsUniqueViolation(result.Error) {
+			WriteProblem(w, r, api.Conflict("Unable to update with unique username"))
 			return
 		} else {
-			logger.Sugar().Errorf("Failed to update player: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to update player: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 			return
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(player)
+	json.NewEncoder(w).Encode(api.NewPlayer(player))
 }
 
 func (s *Server) patchPlayer(w http.ResponseWriter, r *http.Request, id, secret uuid.UUID) {
 
 	var req PlayerUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Invalid request body"))
 		return
 	}
 
@@ -241,10 +232,10 @@ func (s *Server) patchPlayer(w http.ResponseWriter, r *http.Request, id, secret
 	result := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).Where("id = ? AND secret = ? AND deleted_at IS NULL", id, secret).First(&player)
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Player not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Player not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to find player: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to find player: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
@@ -257,18 +248,18 @@ func (s *Server) patchPlayer(w http.ResponseWriter, r *http.Request, id, secret
 
 	result = s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).Save(&player)
 	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "duplicate") || strings.Contains(result.Error.Error(), "unique") {
-			http.Error(w, "Unable to update with unique username", http.StatusConflict)
+		if database.IsUniqueViolation(result.Error) {
+			WriteProblem(w, r, api.Conflict("Unable to update with unique username"))
 			return
 		} else {
-			logger.Sugar().Errorf("Failed to patch player: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to patch player: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 			return
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(player)
+	json.NewEncoder(w).Encode(api.NewPlayer(player))
 }
 
 func (s *Server) deletePlayer(w http.ResponseWriter, r *http.Request, id, secret uuid.UUID) {
@@ -280,24 +271,31 @@ func (s *Server) deletePlayer(w http.ResponseWriter, r *http.Request, id, secret
 		Update("deleted_at", now)
 
 	if result.Error != nil {
-		logger.Sugar().Errorf("Failed to delete player: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Ctx(r.Context()).Errorf("Failed to delete player: %v", result.Error)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Player not found or already deleted", http.StatusNotFound)
+		WriteProblem(w, r, api.NotFound("Player not found or already deleted"))
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) getPlayerHeroes(w http.ResponseWriter, r *http.Request, playerID uuid.UUID) {
+// HandlePlayerHeroes handles GET /api/player/{id}/heroes
+func (s *Server) HandlePlayerHeroes(w http.ResponseWriter, r *http.Request) {
+	playerID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid player ID"))
+		return
+	}
+
 	// Read body to buffer so we can use it multiple times
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		WriteProblem(w, r, api.InvalidRequest("Failed to read request body"))
 		return
 	}
 	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
@@ -311,7 +309,7 @@ func (s *Server) getPlayerHeroes(w http.ResponseWriter, r *http.Request, playerI
 		if err := json.Unmarshal(bodyBytes, &secretStruct); err == nil && secretStruct.Secret != "" {
 			secret, err = uuid.Parse(secretStruct.Secret)
 			if err != nil {
-				http.Error(w, "Invalid player _secret", http.StatusBadRequest)
+				WriteProblem(w, r, api.InvalidRequest("Invalid player _secret"))
 				return
 			}
 		}
@@ -322,7 +320,7 @@ func (s *Server) getPlayerHeroes(w http.ResponseWriter, r *http.Request, playerI
 		var cookieErr error
 		secret, cookieErr = s.extractSecretFromCookie(r)
 		if cookieErr != nil {
-			http.Error(w, "Player secret required (provide _secret in body or login)", http.StatusUnauthorized)
+			WriteProblem(w, r, api.Unauthorized("Player secret required (provide _secret in body or login)"))
 			return
 		}
 	}
@@ -332,23 +330,23 @@ func (s *Server) getPlayerHeroes(w http.ResponseWriter, r *http.Request, playerI
 	result := s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).Where("id = ? AND secret = ? AND deleted_at IS NULL", playerID, secret).First(&player)
 	if result.Error != nil {
 		if result.RowsAffected == 0 {
-			http.Error(w, "Player not found", http.StatusNotFound)
+			WriteProblem(w, r, api.NotFound("Player not found"))
 		} else {
-			logger.Sugar().Errorf("Failed to get player: %v", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Ctx(r.Context()).Errorf("Failed to get player: %v", result.Error)
+			WriteProblem(w, r, api.Internal())
 		}
 		return
 	}
 
 	// Get all heroes for this player
 	var heroes []database.Hero
-	result = s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).Where("player_id = ? AND deleted_at IS NULL", playerID).Preload("Player").Find(&heroes)
+	result = s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).Where("player_id = ? AND deleted_at IS NULL", playerID).Find(&heroes)
 	if result.Error != nil {
-		logger.Sugar().Errorf("Failed to get player heroes: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logger.Ctx(r.Context()).Errorf("Failed to get player heroes: %v", result.Error)
+		WriteProblem(w, r, api.Internal())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(heroes)
+	json.NewEncoder(w).Encode(api.NewHeroes(heroes))
 }
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/expki/backend/pixel-protocol/imagestore"
+	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/expki/backend/pixel-protocol/pixelart"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// uploadHeroPortrait handles PUT /api/hero/:id/image
+func (s *Server) uploadHeroPortrait(w http.ResponseWriter, r *http.Request, heroID uuid.UUID) {
+	// Parse multipart form to get the uploaded image
+	r.Body = http.MaxBytesReader(w, r.Body, 8<<20)
+	err := r.ParseMultipartForm(8 << 20) // 8 MB limit
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Failed to parse multipart form"))
+		return
+	}
+
+	// Extract secret from form or cookie
+	secret, err := s.formSecret(r)
+	if err != nil {
+		WriteProblem(w, r, err)
+		return
+	}
+
+	// Get the hero and verify ownership
+	var hero database.Hero
+	err = s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
+		Where("id = ? AND deleted_at IS NULL", heroID).
+		Preload("Player").
+		First(&hero).Error
+	if err != nil {
+		WriteProblem(w, r, api.NotFound("Hero not found"))
+		return
+	}
+	if hero.Player == nil || hero.Player.Secret != secret {
+		WriteProblem(w, r, api.Unauthorized("Unauthorized"))
+		return
+	}
+
+	// Get the uploaded file
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("No image file provided"))
+		return
+	}
+	defer file.Close()
+	uploadedImageData, err := io.ReadAll(file)
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Failed to read uploaded image"))
+		return
+	}
+
+	// Validate by content and reduce to pixel art, re-encoding drops EXIF and any other metadata
+	uploadedImage, _, err := pixelart.DecodeUpload(uploadedImageData, pixelart.MaxUploadPixels)
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest(fmt.Sprintf("Invalid image: %v", err)))
+		return
+	}
+	portraitData, err := pixelart.EncodePNG(pixelart.Pixelate(uploadedImage))
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to encode portrait: %v", err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+	stored, err := s.images.Put(r.Context(), imagestore.Key{
+		Owner:   imagestore.OwnerHero,
+		ID:      hero.ID,
+		Variant: "portrait-" + imagestore.Hash(portraitData),
+	}, "image/png", portraitData)
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to store portrait: %v", err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+
+	// Queue for moderation, a newer upload replaces a pending one
+	portrait := database.HeroPortrait{
+		ID:         uuid.New(),
+		HeroID:     hero.ID,
+		Hash:       stored.Hash,
+		Status:     database.PortraitStatus_Pending,
+		UploadedAt: time.Now(),
+	}
+	err = s.db.DB.Clauses(dbresolver.Write).WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("hero_id = ? AND status = ?", hero.ID, database.PortraitStatus_Pending).
+			Delete(&database.HeroPortrait{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&portrait).Error
+	})
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to queue portrait: %v", err)
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(api.NewPortrait(portrait))
+}
+
+// getApprovedPortrait returns the latest approved portrait of the hero, scaled per request
+func (s *Server) getApprovedPortrait(ctx context.Context, heroID uuid.UUID) (imagestore.Image, error) {
+	var portrait database.HeroPortrait
+	err := s.db.DB.Clauses(dbresolver.Read).WithContext(ctx).
+		Where("hero_id = ? AND status = ?", heroID, database.PortraitStatus_Approved).
+		Order("reviewed_at DESC").
+		Take(&portrait).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return imagestore.Image{}, imagestore.ErrNotFound
+	} else if err != nil {
+		return imagestore.Image{}, err
+	}
+	return s.images.Lookup(ctx, imagestore.Key{
+		Owner:   imagestore.OwnerHero,
+		ID:      heroID,
+		Variant: "portrait-" + portrait.Hash,
+	})
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/logger"
+)
+
+// WriteProblem renders err as application/problem+json.
+// Errors that are not an *api.Problem are logged and reported as internal so their cause never reaches the client.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	var problem *api.Problem
+	if !errors.As(err, &problem) {
+		logger.Ctx(r.Context()).Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		problem = api.Internal()
+	}
+	response := *problem
+	response.Instance = r.URL.Path
+
+	if response.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(response.RetryAfter))
+	}
+	w.Header().Set("Content-Type", api.ContentTypeProblem)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(response.Status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/expki/backend/pixel-protocol/imagestore"
+	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/expki/backend/pixel-protocol/metrics"
+	"github.com/expki/backend/pixel-protocol/pixelart"
+	"github.com/google/uuid"
+	"gorm.io/plugin/dbresolver"
+)
+
+// HandleFightReplay handles GET /api/hero/{id}/fight/{fightId}/replay.gif
+func (s *Server) HandleFightReplay(w http.ResponseWriter, r *http.Request) {
+	heroID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid hero ID"))
+		return
+	}
+
+	fightID, err := uuid.Parse(r.PathValue("fightId"))
+	if err != nil {
+		WriteProblem(w, r, api.InvalidRequest("Invalid fight ID"))
+		return
+	}
+
+	// Get fight details from database
+	var fight database.Fight
+	err = s.db.DB.Clauses(dbresolver.Read).WithContext(r.Context()).
+		Where("id = ? AND (attacker_id = ? OR defender_id = ?)", fightID, heroID, heroID).
+		Preload("Attacker").
+		Preload("Defender").
+		First(&fight).Error
+
+	if err != nil || fight.Attacker == nil || fight.Defender == nil {
+		WriteProblem(w, r, api.NotFound("Fight not found"))
+		return
+	}
+
+	// Serve from the image store, rendering the replay on first request.
+	// The avatars are part of the key so a renamed hero gets a fresh replay, the stale one is removed.
+	key := imagestore.Key{
+		Owner:   imagestore.OwnerFight,
+		ID:      fight.ID,
+		Variant: fmt.Sprintf("replay-%s-%s", avatarDigest(*fight.Attacker), avatarDigest(*fight.Defender)),
+	}
+	stored, err := s.images.Lookup(r.Context(), key)
+	if errors.Is(err, imagestore.ErrNotFound) {
+		var imageData []byte
+		imageData, err = s.getFightReplay(fight)
+		if err == nil {
+			stored, err = s.images.Put(r.Context(), key, "image/gif", imageData)
+		}
+		if err == nil {
+			s.pruneVariants(r.Context(), key, "replay-")
+		}
+	}
+	if err != nil {
+		logger.Ctx(r.Context()).Errorf("Failed to get fight replay: %v", err)
+		metrics.ImageFailures.WithLabelValues(metrics.ImageReplay).Inc()
+		WriteProblem(w, r, api.Internal())
+		return
+	}
+
+	s.serveStoredImage(w, r, stored, "public, max-age=86400") // Cache for 1 day
+}
+
+func (s *Server) getFightReplay(fight database.Fight) ([]byte, error) {
+	winner := fightWinner(fight)
+	replay := pixelart.Replay{
+		Attacker: pixelart.New(fight.Attacker.ID.String(), fight.Attacker.Title, fight.Attacker.Country),
+		Defender: pixelart.New(fight.Defender.ID.String(), fight.Defender.Title, fight.Defender.Country),
+		Winner:   winner,
+		Rounds:   pixelart.NewRounds(fight.ID.String(), winner),
+	}
+	return replay.GIF()
+}
+
+// fightWinner maps the attacker outcome of the fight to the winning side
+func fightWinner(fight database.Fight) pixelart.Side {
+	switch fight.Outcome {
+	case database.FightOutcome_Victory:
+		return pixelart.SideAttacker
+	case database.FightOutcome_Defeat:
+		return pixelart.SideDefender
+	default:
+		return pixelart.SideNone
+	}
+}
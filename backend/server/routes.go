@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/api"
+)
+
+// Route is an API endpoint, the path is relative to the mount of its version
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+}
+
+// Mount places the routes of an API version under a path prefix
+type Mount struct {
+	Prefix  string
+	Version string
+	Routes  []Route
+
+	// Deprecation and Sunset are announced on every response when set, see RFC 9745 and RFC 8594
+	Deprecation time.Time
+	Sunset      time.Time
+	// Successor is the prefix clients should migrate to
+	Successor string
+}
+
+// LatestVersion is the version served by the unversioned swagger endpoints
+const LatestVersion = "v1"
+
+// The unversioned /api alias of v1
+var (
+	legacyDeprecation = time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	legacySunset      = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Mounts returns every mounted API version.
+// A new version reuses the handlers, only routes whose response changes need a version check via RequestVersion.
+func (s *Server) Mounts() []Mount {
+	v1 := s.routesV1()
+	return []Mount{
+		{Prefix: "/api/v1", Version: "v1", Routes: v1},
+		{Prefix: "/api", Version: "v1", Routes: v1, Deprecation: legacyDeprecation, Sunset: legacySunset, Successor: "/api/v1"},
+	}
+}
+
+// Register adds the routes of every mount to mux with wrap applied to each handler.
+// The rest of a mount prefix is answered with a not_found or method_not_allowed problem instead of the plain text of the mux.
+func (s *Server) Register(mux *http.ServeMux, wrap func(http.Handler) http.Handler) {
+	for _, mount := range s.Mounts() {
+		for _, route := range mount.Routes {
+			mux.Handle(mount.Pattern(route), wrap(mount.Handler(route)))
+		}
+		mux.Handle(mount.Prefix+"/", unmatched(mux, mount.Prefix+"/"))
+	}
+}
+
+// unmatched answers requests that reached the catch-all pattern of a mount.
+// The path exists when another method routes elsewhere, that is a 405 listing the methods in Allow.
+func unmatched(mux *http.ServeMux, pattern string) http.HandlerFunc {
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed := make([]string, 0, len(methods))
+		for _, method := range methods {
+			probe := &http.Request{Method: method, URL: r.URL, Host: r.Host, Header: http.Header{}}
+			if _, matched := mux.Handler(probe); matched != pattern {
+				allowed = append(allowed, method)
+			}
+		}
+		if len(allowed) == 0 {
+			WriteProblem(w, r, api.NotFound("No such endpoint"))
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		WriteProblem(w, r, api.MethodNotAllowed(fmt.Sprintf("%s is not allowed, use %s", r.Method, strings.Join(allowed, ", "))))
+	}
+}
+
+// Pattern returns the http.ServeMux pattern of the route, e.g. "GET /api/v1/hero/{id}/fights"
+func (m Mount) Pattern(route Route) string {
+	return route.Method + " " + m.Prefix + route.Path
+}
+
+// Handler tags requests with the version of the mount and announces deprecation
+func (m Mount) Handler(route Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Deprecation.IsZero() {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", m.Deprecation.Unix()))
+		}
+		if !m.Sunset.IsZero() {
+			w.Header().Set("Sunset", m.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if m.Successor != "" {
+			w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, m.Successor, r.URL.Path[len(m.Prefix):]))
+		}
+		route.Handler(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, m.Version)))
+	})
+}
+
+type versionKey struct{}
+
+// RequestVersion returns the API version the request was routed through
+func RequestVersion(r *http.Request) string {
+	if version, ok := r.Context().Value(versionKey{}).(string); ok {
+		return version
+	}
+	return LatestVersion
+}
+
+// routesV1 returns the endpoints of v1, the paths match swagger/v1.yaml
+func (s *Server) routesV1() []Route {
+	routes := []Route{
+		// Player
+		{http.MethodPost, "/player", s.HandlePlayer},
+		{http.MethodGet, "/player/{id}", s.HandlePlayer},
+		{http.MethodPut, "/player/{id}", s.HandlePlayer},
+		{http.MethodPatch, "/player/{id}", s.HandlePlayer},
+		{http.MethodDelete, "/player/{id}", s.HandlePlayer},
+		{http.MethodGet, "/player/{id}/heroes", s.HandlePlayerHeroes},
+		{http.MethodGet, "/player/{id}/fights", s.HandlePlayerFights},
+		{http.MethodGet, "/player/{id}/fight/{fightId}", s.HandlePlayerFight},
+
+		// Hero
+		{http.MethodPost, "/hero", s.HandleHero},
+		{http.MethodGet, "/hero/{id}", s.HandleHero},
+		{http.MethodPut, "/hero/{id}", s.HandleHero},
+		{http.MethodPatch, "/hero/{id}", s.HandleHero},
+		{http.MethodDelete, "/hero/{id}", s.HandleHero},
+		{http.MethodGet, "/hero/{id}/image", s.HandleHeroImage},
+		{http.MethodPut, "/hero/{id}/image", s.HandleHeroImage},
+
+		// Fight
+		{http.MethodPost, "/hero/{id}/fight", s.HandleCreateFight},
+		{http.MethodGet, "/hero/{id}/fights", s.HandleHeroFights},
+		{http.MethodGet, "/hero/{id}/fight/{fightId}", s.HandleHeroFight},
+		{http.MethodGet, "/hero/{id}/fight/{fightId}/image", s.HandleFightImage},
+		{http.MethodPost, "/hero/{id}/fight/{fightId}/image", s.HandleFightImage},
+		{http.MethodGet, "/hero/{id}/fight/{fightId}/replay.gif", s.HandleFightReplay},
+	}
+
+	// Admin, moved to the admin listener when one is configured
+	if s.publicAdmin() {
+		routes = append(routes,
+			Route{http.MethodGet, "/admin/portraits", s.HandleAdminPortraits},
+			Route{http.MethodGet, "/admin/portraits/{portraitId}/image", s.HandleAdminPortraitImage},
+			Route{http.MethodPost, "/admin/portraits/{portraitId}/approve", s.HandleAdminPortraitApprove},
+			Route{http.MethodPost, "/admin/portraits/{portraitId}/reject", s.HandleAdminPortraitReject},
+		)
+	}
+	return routes
+}
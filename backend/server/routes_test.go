@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/config"
+	"gopkg.in/yaml.v3"
+)
+
+var pathParameter = regexp.MustCompile(`\{[^}]+\}`)
+
+// routingMux registers the API like main does, the routed handlers only echo the pattern the mux matched
+func routingMux(admin config.ConfigAdmin) *http.ServeMux {
+	mux := http.NewServeMux()
+	New(nil, nil, nil, admin).Register(mux, func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Pattern", r.Pattern)
+		})
+	})
+	return mux
+}
+
+// swaggerOperations returns the "METHOD /path" operations documented for the version
+func swaggerOperations(t *testing.T, version string) []string {
+	t.Helper()
+	document, err := swaggerFS.ReadFile("swagger/" + version + ".yaml")
+	if err != nil {
+		t.Fatalf("read swagger: %v", err)
+	}
+	var spec struct {
+		Paths map[string]map[string]any `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(document, &spec); err != nil {
+		t.Fatalf("parse swagger: %v", err)
+	}
+	var operations []string
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			if method == "parameters" {
+				continue
+			}
+			operations = append(operations, strings.ToUpper(method)+" "+path)
+		}
+	}
+	slices.Sort(operations)
+	return operations
+}
+
+func TestRoutesMatchSwagger(t *testing.T) {
+	operations := swaggerOperations(t, "v1")
+	if len(operations) == 0 {
+		t.Fatal("swagger documents no operations")
+	}
+
+	var routed []string
+	for _, route := range New(nil, nil, nil, config.ConfigAdmin{}).routesV1() {
+		routed = append(routed, route.Method+" "+route.Path)
+	}
+	slices.Sort(routed)
+	if !slices.Equal(routed, operations) {
+		t.Errorf("routes differ from swagger\nroutes:  %v\nswagger: %v", routed, operations)
+	}
+
+	mux := routingMux(config.ConfigAdmin{})
+	for _, prefix := range []string{"/api/v1", "/api"} {
+		for _, operation := range operations {
+			method, path, _ := strings.Cut(operation, " ")
+			target := prefix + pathParameter.ReplaceAllString(path, "0b6e0c1e-3c0f-4b8e-9a51-3d3c0a4b0c55")
+			t.Run(method+" "+target, func(t *testing.T) {
+				recorder := httptest.NewRecorder()
+				mux.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+				if want := method + " " + prefix + path; recorder.Header().Get("X-Pattern") != want {
+					t.Errorf("routed to %q, want %q (status %d)", recorder.Header().Get("X-Pattern"), want, recorder.Code)
+				}
+			})
+		}
+	}
+}
+
+func TestRoutesUnmatched(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		status int
+		allow  string
+	}{
+		{http.MethodGet, "/api/hero/x/imagefight", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/v1/hero/x/imagefight", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/v1/hero/x/fightimage", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/v1/hero/x/fight/y/image/extra", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/v1/unknown", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/v2/hero/x", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/v1/hero", http.StatusMethodNotAllowed, "POST"},
+		{http.MethodDelete, "/api/v1/hero/x/fights", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodPut, "/api/hero/x/fight", http.StatusMethodNotAllowed, "POST"},
+		{http.MethodPost, "/api/v1/hero/x/fight/y/replay.gif", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodDelete, "/api/v1/hero/x/image", http.StatusMethodNotAllowed, "GET, HEAD, PUT"},
+		{http.MethodPost, "/api/v1/player/x", http.StatusMethodNotAllowed, "GET, HEAD, PUT, PATCH, DELETE"},
+	}
+	mux := routingMux(config.ConfigAdmin{})
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, nil))
+			if recorder.Code != test.status {
+				t.Fatalf("status %d, want %d", recorder.Code, test.status)
+			}
+			if pattern := recorder.Header().Get("X-Pattern"); pattern != "" {
+				t.Errorf("routed to %q", pattern)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != api.ContentTypeProblem {
+				t.Errorf("content type %q, want %q", contentType, api.ContentTypeProblem)
+			}
+			if allow := recorder.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("allow %q, want %q", allow, test.allow)
+			}
+			var problem api.Problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if problem.Status != test.status || problem.Instance != test.target {
+				t.Errorf("problem %+v", problem)
+			}
+		})
+	}
+}
+
+// TestRoutesAdminListener checks that moderation leaves the public listeners once an admin listener is configured
+func TestRoutesAdminListener(t *testing.T) {
+	admin := config.ConfigAdmin{Token: "token", Address: ":9443", ClientCA: "clients.pem"}
+	mux := routingMux(admin)
+	for _, operation := range swaggerOperations(t, "v1") {
+		method, path, _ := strings.Cut(operation, " ")
+		if !strings.HasPrefix(path, "/admin/") {
+			continue
+		}
+		for _, prefix := range []string{"/api/v1", "/api"} {
+			target := prefix + pathParameter.ReplaceAllString(path, "0b6e0c1e-3c0f-4b8e-9a51-3d3c0a4b0c55")
+			request := httptest.NewRequest(method, target, nil)
+			request.Header.Set("Authorization", "Bearer "+admin.Token)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusNotFound || recorder.Header().Get("X-Pattern") != "" {
+				t.Errorf("%s %s: status %d, routed to %q", method, target, recorder.Code, recorder.Header().Get("X-Pattern"))
+			}
+		}
+	}
+
+	// a handler reached without a verified client certificate refuses the token once client certificates are configured
+	request := httptest.NewRequest(http.MethodGet, "/admin/portraits", nil)
+	request.Header.Set("Authorization", "Bearer "+admin.Token)
+	recorder := httptest.NewRecorder()
+	New(nil, nil, nil, admin).HandleAdminPortraits(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("bearer token accepted with client certificates: status %d", recorder.Code)
+	}
+
+	// without client certificates the admin listener checks the token
+	request = httptest.NewRequest(http.MethodGet, "/admin/portraits", nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+	recorder = httptest.NewRecorder()
+	New(nil, nil, nil, config.ConfigAdmin{Token: "token", Address: ":9090"}).HandleAdminPortraits(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("wrong bearer token on the admin listener: status %d", recorder.Code)
+	}
+}
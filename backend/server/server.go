@@ -1,25 +1,94 @@
 package server
 
 import (
+	"context"
 	"net/http"
+	"sync"
 
-	"github.com/expki/backend/pixel-protocol/claude"
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/config"
 	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/expki/backend/pixel-protocol/imagestore"
+	"github.com/expki/backend/pixel-protocol/tracing"
 	"github.com/google/uuid"
 )
 
+var tracer = tracing.Tracer("github.com/expki/backend/pixel-protocol/server")
+
+// Judge decides the outcome of a fight and narrates it, *claude.Client in production
+type Judge interface {
+	GenerateCombatNarrative(ctx context.Context, attacker, defender database.Hero) (narrative string, outcome database.FightOutcome, err error)
+}
+
 type Server struct {
 	db     *database.Database
-	claude *claude.Client
+	judge  Judge
+	images imagestore.Store
+	admin  config.ConfigAdmin
+	tasks  tasks
 }
 
-func New(db *database.Database, claudeClient *claude.Client) *Server {
+func New(db *database.Database, judge Judge, images imagestore.Store, admin config.ConfigAdmin) *Server {
 	return &Server{
 		db:     db,
-		claude: claudeClient,
+		judge:  judge,
+		images: images,
+		admin:  admin,
 	}
 }
 
+// publicAdmin reports whether moderation is served on the public listeners behind the bearer token.
+// With an admin address it is only served by the admin listener, with a client CA behind a client certificate and role
+// and otherwise behind the bearer token.
+func (s *Server) publicAdmin() bool {
+	return s.admin.Address == ""
+}
+
+// Drain stops new fights from starting, they are answered with 503 from now on
+func (s *Server) Drain() {
+	s.tasks.mutex.Lock()
+	s.tasks.closed = true
+	s.tasks.mutex.Unlock()
+}
+
+// Wait stops new fights from starting and blocks until the in-flight ones finished or ctx is done
+func (s *Server) Wait(ctx context.Context) error {
+	s.Drain()
+	done := make(chan struct{})
+	go func() {
+		s.tasks.group.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tasks tracks work that has to finish before the database closes
+type tasks struct {
+	mutex  sync.Mutex
+	closed bool
+	group  sync.WaitGroup
+}
+
+// start registers a task, it returns false once shutdown began
+func (t *tasks) start() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return false
+	}
+	t.group.Add(1)
+	return true
+}
+
+func (t *tasks) done() {
+	t.group.Done()
+}
+
 // PlayerSecret represents the secret authentication structure
 type PlayerSecret struct {
 	Secret string `json:"_secret"`
@@ -33,6 +102,22 @@ func (s *Server) extractSecretFromCookie(r *http.Request) (uuid.UUID, error) {
 	return uuid.Nil, &SecretNotFoundError{}
 }
 
+// formSecret returns the player secret of a form request, from the _secret field or the player_secret cookie
+func (s *Server) formSecret(r *http.Request) (uuid.UUID, error) {
+	if secretStr := r.FormValue("_secret"); secretStr != "" {
+		secret, err := uuid.Parse(secretStr)
+		if err != nil {
+			return uuid.Nil, api.InvalidRequest("Invalid player _secret")
+		}
+		return secret, nil
+	}
+	secret, err := s.extractSecretFromCookie(r)
+	if err != nil {
+		return uuid.Nil, api.Unauthorized("Player secret required (provide _secret in form or login)")
+	}
+	return secret, nil
+}
+
 // setPlayerSecretCookie sets a secure, long-lasting cookie with the player secret
 func (s *Server) setPlayerSecretCookie(r *http.Request, w http.ResponseWriter, secret uuid.UUID) { // Check if the request was made over HTTPS
 	isHTTPS := r.TLS != nil ||
@@ -1,47 +1,129 @@
 package server
 
 import (
-	_ "embed"
+	"embed"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io/fs"
 	"net/http"
+	"path"
+	"strings"
 
+	"github.com/expki/backend/pixel-protocol/api"
 	"gopkg.in/yaml.v3"
 )
 
-//go:embed swagger.yaml
-var swaggerYAML []byte
+//go:embed swagger/*.yaml
+var swaggerFS embed.FS
 
-// SwaggerJSON converts the embedded YAML to JSON for compatibility
-func getSwaggerJSON() ([]byte, error) {
-	var data interface{}
+// swaggerVersions lists the versions the Swagger UI offers, newest first
+var swaggerVersions = []string{LatestVersion}
+
+// getSwaggerSpec parses the embedded YAML of the version and replaces the response schemas with the ones generated from the api package
+func getSwaggerSpec(version string) (map[string]any, error) {
+	swaggerYAML, err := swaggerFS.ReadFile("swagger/" + version + ".yaml")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, api.NotFound("Unknown API version")
+	} else if err != nil {
+		return nil, err
+	}
+	var data map[string]any
 	if err := yaml.Unmarshal(swaggerYAML, &data); err != nil {
 		return nil, err
 	}
+	components, _ := data["components"].(map[string]any)
+	if components == nil {
+		components = map[string]any{}
+		data["components"] = components
+	}
+	schemas, _ := components["schemas"].(map[string]any)
+	if schemas == nil {
+		schemas = map[string]any{}
+		components["schemas"] = schemas
+	}
+	for name, schema := range api.Schemas() {
+		schemas[name] = schema
+	}
+
+	// The paths are relative to the mount of the version
+	servers, _ := data["servers"].([]any)
+	for _, server := range servers {
+		if server, ok := server.(map[string]any); ok {
+			url, _ := server["url"].(string)
+			server["url"] = strings.TrimSuffix(url, "/") + "/api/" + version
+		}
+	}
+
+	// Every error response is a problem, document it where the specification leaves the content out
+	paths, _ := data["paths"].(map[string]any)
+	for _, pathItem := range paths {
+		operations, _ := pathItem.(map[string]any)
+		for _, operation := range operations {
+			operation, _ := operation.(map[string]any)
+			responses, _ := operation["responses"].(map[string]any)
+			for status, response := range responses {
+				response, _ := response.(map[string]any)
+				if response == nil || response["content"] != nil || len(status) != 3 || status[0] < '4' {
+					continue
+				}
+				response["content"] = map[string]any{
+					api.ContentTypeProblem: map[string]any{
+						"schema": map[string]any{"$ref": "#/components/schemas/Problem"},
+					},
+				}
+			}
+		}
+	}
+	return data, nil
+}
+
+// getSwaggerJSON converts the embedded YAML to JSON for compatibility
+func getSwaggerJSON(version string) ([]byte, error) {
+	data, err := getSwaggerSpec(version)
+	if err != nil {
+		return nil, err
+	}
 	return json.Marshal(data)
 }
 
-// HandleSwagger serves the Swagger UI
+// getSwaggerYAML renders the specification including the generated schemas
+func getSwaggerYAML(version string) ([]byte, error) {
+	data, err := getSwaggerSpec(version)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(data)
+}
+
+// HandleSwagger serves the Swagger UI and the specification of every version, the unversioned files are the latest version
 func (s *Server) HandleSwagger(w http.ResponseWriter, r *http.Request) {
-	// Serve different content based on the path
-	path := r.URL.Path
+	version := r.PathValue("version")
+	if version == "" {
+		version = LatestVersion
+	}
 
-	switch path {
-	case "/swagger", "/swagger/":
-		// Serve the Swagger UI HTML
-		serveSwaggerUI(w, r)
-	case "/swagger/swagger.json":
+	// Serve different content based on the file name
+	switch path.Base(r.URL.Path) {
+	case "swagger.json":
 		// Serve the OpenAPI specification as JSON
-		serveSwaggerJSON(w, r)
-	case "/swagger/swagger.yaml":
+		serveSwaggerJSON(w, r, version)
+	case "swagger.yaml":
 		// Serve the OpenAPI specification as YAML
-		serveSwaggerYAML(w, r)
+		serveSwaggerYAML(w, r, version)
 	default:
-		http.NotFound(w, r)
+		// Serve the Swagger UI HTML
+		serveSwaggerUI(w, r)
 	}
 }
 
 func serveSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	// One entry per version in the definition selector
+	urls := []map[string]string{}
+	for _, version := range swaggerVersions {
+		urls = append(urls, map[string]string{"name": version, "url": "/swagger/" + version + "/swagger.json"})
+	}
+	urlsJSON, _ := json.Marshal(urls)
+
 	html := `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -70,7 +152,7 @@ func serveSwaggerUI(w http.ResponseWriter, r *http.Request) {
     <script>
         window.onload = function() {
             window.ui = SwaggerUIBundle({
-                url: "/swagger/swagger.json",
+                urls: ` + string(urlsJSON) + `,
                 dom_id: '#swagger-ui',
                 deepLinking: true,
                 presets: [
@@ -98,10 +180,10 @@ func serveSwaggerUI(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(html))
 }
 
-func serveSwaggerJSON(w http.ResponseWriter, r *http.Request) {
-	jsonData, err := getSwaggerJSON()
+func serveSwaggerJSON(w http.ResponseWriter, r *http.Request, version string) {
+	jsonData, err := getSwaggerJSON(version)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to convert swagger spec: %v", err), http.StatusInternalServerError)
+		WriteProblem(w, r, errors.Join(errors.New("failed to convert swagger spec"), err))
 		return
 	}
 
@@ -110,8 +192,14 @@ func serveSwaggerJSON(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonData)
 }
 
-func serveSwaggerYAML(w http.ResponseWriter, r *http.Request) {
+func serveSwaggerYAML(w http.ResponseWriter, r *http.Request, version string) {
+	yamlData, err := getSwaggerYAML(version)
+	if err != nil {
+		WriteProblem(w, r, errors.Join(errors.New("failed to convert swagger spec"), err))
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/x-yaml")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Write(swaggerYAML)
+	w.Write(yamlData)
 }
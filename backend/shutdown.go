@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/config"
+	"github.com/expki/backend/pixel-protocol/logger"
+	"github.com/expki/backend/pixel-protocol/server"
+)
+
+// shutdownSignals start the graceful shutdown
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// listener is a public server drained on shutdown, http.Server and http3.Server
+type listener interface {
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+// drain fails readiness and keeps serving for the drain delay so load balancers stop routing.
+// It then stops new fights, drains every listener at once and waits for the fights that outlive their connection.
+// The shutdown timeout bounds the drain, the database may be closed once drain returned.
+func drain(cfg config.ConfigServer, health *server.Health, srv *server.Server, listeners map[string]listener) {
+	health.SetDraining()
+
+	// Keep serving until load balancers noticed the failing readiness probe
+	if drainDelay := time.Duration(cfg.DrainDelay); drainDelay > 0 {
+		logger.Sugar().Infof("Readiness fails, closing the listeners in %s", drainDelay)
+		time.Sleep(drainDelay)
+	}
+	srv.Drain()
+
+	// Stop accepting and drain every protocol at once, the drain shares one deadline
+	shutdownTimeout := cfg.ShutdownTimeout.Duration(30 * time.Second)
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelDrain()
+	var group sync.WaitGroup
+	for name, listener := range listeners {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			err := listener.Shutdown(drainCtx)
+			if err != nil {
+				logger.Sugar().Warnf("Drain %s: %v", name, err)
+			}
+		}()
+	}
+	group.Wait()
+
+	// Wait for fights that outlive their connection
+	err := srv.Wait(drainCtx)
+	if err != nil {
+		logger.Sugar().Warnf("Fights still running after %s, closing anyway: %v", shutdownTimeout, err)
+	}
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
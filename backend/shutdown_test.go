@@ -0,0 +1,201 @@
+//go:build sqlite
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/config"
+	"github.com/expki/backend/pixel-protocol/database"
+	"github.com/expki/backend/pixel-protocol/server"
+	"github.com/google/uuid"
+)
+
+// blockingJudge holds the first fight inside the judge call until release is closed
+type blockingJudge struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (j *blockingJudge) GenerateCombatNarrative(ctx context.Context, attacker, defender database.Hero) (string, database.FightOutcome, error) {
+	close(j.entered)
+	<-j.release
+	return attacker.Title + " outwits " + defender.Title, database.FightOutcome_Victory, nil
+}
+
+func TestShutdownDrainsFight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := config.Config{
+		Server: config.ConfigServer{
+			DrainDelay:      config.Duration(300 * time.Millisecond),
+			ShutdownTimeout: config.Duration(10 * time.Second),
+		},
+		Database: config.Database{Connection: []string{filepath.Join(t.TempDir(), "fights.db")}, LogLevel: "silent"},
+	}
+	if err := cfg.TLS.Configurate(ctx); err != nil {
+		t.Fatalf("Configurate: %v", err)
+	}
+	db, err := database.New(ctx, cfg.Database)
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+
+	secret := uuid.New()
+	player := database.Player{ID: uuid.New(), UserName: "Drain", UserNameSuffix: 1, Secret: secret}
+	attacker := database.Hero{ID: uuid.New(), Country: "US", Elo: 1000, Title: "Knight", Description: "A knight", PlayerID: player.ID}
+	defender := database.Hero{ID: uuid.New(), Country: "US", Elo: 1000, Title: "Mage", Description: "A mage", PlayerID: player.ID}
+	for _, record := range []any{&player, &attacker, &defender} {
+		if err := db.DB.Create(record).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	judge := &blockingJudge{entered: make(chan struct{}), release: make(chan struct{})}
+	srv := server.New(db, judge, nil, config.ConfigAdmin{})
+	health := server.NewHealth(&cfg, db, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /readyz", health.HandleReadyz)
+	srv.Register(mux, func(h http.Handler) http.Handler { return h })
+
+	socket, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	public := &http.Server{Handler: mux}
+	go public.Serve(socket)
+	base := "http://" + socket.Addr().String()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	fightURL := "/api/v1/hero/" + attacker.ID.String() + "/fight"
+	fightBody := `{"_secret":"` + secret.String() + `"}`
+	type fightResponse struct {
+		status int
+		result api.FightResult
+		err    error
+	}
+	fought := make(chan fightResponse, 1)
+	go func() {
+		response, err := client.Post(base+fightURL, "application/json", strings.NewReader(fightBody))
+		if err != nil {
+			fought <- fightResponse{err: err}
+			return
+		}
+		defer response.Body.Close()
+		var result api.FightResult
+		err = json.NewDecoder(response.Body).Decode(&result)
+		fought <- fightResponse{status: response.StatusCode, result: result, err: err}
+	}()
+	select {
+	case <-judge.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fight never reached the judge")
+	}
+
+	// SIGTERM arrives while the fight waits for the judge
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, shutdownSignals...)
+	defer signal.Stop(interrupt)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("kill: %v", err)
+	}
+	select {
+	case <-interrupt:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM not delivered")
+	}
+	drained := make(chan struct{})
+	go func() {
+		drain(cfg.Server, health, srv, map[string]listener{"http": public})
+		close(drained)
+	}()
+
+	// During the drain delay the listener still serves and readiness fails
+	response, err := client.Get(base + "/readyz")
+	if err != nil {
+		t.Fatalf("readyz during drain delay: %v", err)
+	}
+	var readiness api.Readiness
+	json.NewDecoder(response.Body).Decode(&readiness)
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable || readiness.Checks["shutdown"].Status != api.CheckDraining {
+		t.Errorf("readyz during drain: status %d, checks %+v", response.StatusCode, readiness.Checks)
+	}
+
+	// Once the listener stopped accepting, fights that still reach the server are refused
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		connection, err := net.Dial("tcp", socket.Addr().String())
+		if err != nil {
+			break
+		}
+		connection.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("listener still accepting after the drain delay")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, fightURL, strings.NewReader(fightBody)))
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Content-Type") != api.ContentTypeProblem {
+		t.Errorf("new fight while draining: status %d, content type %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	// The drain holds until the in-flight fight committed
+	select {
+	case <-drained:
+		t.Fatal("drain returned while a fight was inside the judge call")
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(judge.release)
+	var fight fightResponse
+	select {
+	case fight = <-fought:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fight never answered")
+	}
+	if fight.err != nil || fight.status != http.StatusCreated {
+		t.Fatalf("fight: status %d, err %v", fight.status, fight.err)
+	}
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not return after the fight finished")
+	}
+
+	// Everything is committed before main closes the database
+	var stored database.Fight
+	if err := db.DB.Where("id = ?", fight.result.Fight.ID).First(&stored).Error; err != nil {
+		t.Fatalf("fight row: %v", err)
+	}
+	if stored.Outcome != database.FightOutcome_Victory || stored.DefenderID != defender.ID {
+		t.Errorf("fight row %+v", stored)
+	}
+	var heroes []database.Hero
+	db.DB.Where("id IN ?", []uuid.UUID{attacker.ID, defender.ID}).Find(&heroes)
+	for _, hero := range heroes {
+		want := int32(1000) + fight.result.EloGain
+		if hero.ID == defender.ID {
+			want = int32(1000) - fight.result.EloGain
+		}
+		if fight.result.EloGain <= 0 || int32(hero.Elo) != want {
+			t.Errorf("hero %s elo %d, want %d (gain %d)", hero.Title, hero.Elo, want, fight.result.EloGain)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+}
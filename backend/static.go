@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/expki/backend/pixel-protocol/api"
+	"github.com/expki/backend/pixel-protocol/middleware"
+	"github.com/expki/backend/pixel-protocol/server"
+)
+
+// viteHashedAsset matches the build output Vite names after the content hash, e.g. assets/index-Vw8_TEYN.js
+var viteHashedAsset = regexp.MustCompile(`^assets/.+-[A-Za-z0-9_-]{8}\.[a-z0-9]+$`)
+
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+	spaIndex        = "index.html"
+)
+
+// staticHandler serves the embedded React app.
+// Paths without a file extension are client routes and fall back to index.html, missing files with an extension are a 404.
+func staticHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// unknown API paths must not turn into the app shell
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			server.WriteProblem(w, r, api.NotFound("No such endpoint"))
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" {
+			name = spaIndex
+		}
+		asset, ok := staticAssets[name]
+		if !ok && path.Ext(name) == "" {
+			name = spaIndex
+			asset, ok = staticAssets[name]
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		offered := make([]string, 0, len(middleware.Encodings))
+		for _, coding := range middleware.Encodings {
+			if _, ok := asset.content[coding]; ok {
+				offered = append(offered, coding)
+			}
+		}
+		coding := middleware.Negotiate(r.Header.Get("Accept-Encoding"), offered)
+
+		header := w.Header()
+		if len(offered) > 0 {
+			header.Add("Vary", "Accept-Encoding")
+		}
+		header.Set("Content-Type", asset.contentType)
+		header.Set("ETag", asset.etag[coding])
+		if viteHashedAsset.MatchString(name) {
+			header.Set("Cache-Control", cacheImmutable)
+		} else {
+			header.Set("Cache-Control", cacheRevalidate)
+		}
+		// ServeContent answers conditional and range requests from the ETag, the encoding only belongs on a body
+		writer := w
+		if coding != "" {
+			writer = &encodedWriter{ResponseWriter: w, coding: coding}
+		}
+		http.ServeContent(writer, r, name, time.Time{}, bytes.NewReader(asset.content[coding]))
+	})
+}
+
+// encodedWriter labels a precompressed body with its coding, a 304 or error response carries none
+type encodedWriter struct {
+	http.ResponseWriter
+	coding      string
+	wroteHeader bool
+}
+
+func (w *encodedWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status == http.StatusOK || status == http.StatusPartialContent {
+			w.Header().Set("Content-Encoding", w.coding)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *encodedWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/expki/backend/pixel-protocol/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies the spans of this server
+const ServiceName = "pixel-protocol"
+
+// Tracer returns the tracer of an instrumented package
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Setup installs the global tracer provider and propagator for the configured exporter.
+// The returned shutdown flushes pending spans, tracing stays a no-op when no exporter is configured.
+func Setup(ctx context.Context, cfg config.ConfigTracing) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var output io.Closer
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case config.TraceExporterOTLP:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case config.TraceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case config.TraceExporterFile:
+		var file *os.File
+		file, err = os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("could not open trace file %q", cfg.Path), err)
+		}
+		output = file
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("could not create trace exporter"), err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(ServiceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if output != nil {
+			err = errors.Join(err, output.Close())
+		}
+		return err
+	}, nil
+}
+
+// Middleware starts a server span per request continuing the trace of the caller.
+// The span starts out named after the method and is renamed after the route once the http.ServeMux matched one.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if route := route(r); route != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(spanName(r))
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+	}), "http.server", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return spanName(r)
+	}))
+}
+
+// route returns the path of the pattern the request was routed by, empty before routing
+func route(r *http.Request) string {
+	if _, path, found := strings.Cut(r.Pattern, " "); found {
+		return path
+	}
+	return r.Pattern
+}
+
+// spanName is "METHOD /route", only the method until the request was routed
+func spanName(r *http.Request) string {
+	if route := route(r); route != "" {
+		return r.Method + " " + route
+	}
+	return r.Method
+}
+
+// Transport creates a client span per outgoing request and propagates the trace
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(next)
+}
+
+// RecordError marks the span as failed
+func RecordError(span trace.Span, err error, attributes ...attribute.KeyValue) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err, trace.WithAttributes(attributes...))
+	span.SetStatus(codes.Error, err.Error())
+}
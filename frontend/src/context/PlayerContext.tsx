@@ -1,7 +1,7 @@
 import React, { createContext, useState, useEffect, useCallback } from 'react';
 import type { ReactNode } from 'react';
 import type { Player, Hero } from '../types/api';
-import { apiService } from '../services/api';
+import { apiService, ProblemError } from '../services/api';
 
 export interface PlayerContextType {
   player: Player | null;
@@ -22,6 +22,18 @@ interface PlayerProviderProps {
   children: ReactNode;
 }
 
+// Register a player under a generated name, a name taken in the meantime is retried once with a fresh one
+const createGeneratedPlayer = async (): Promise<Player> => {
+  try {
+    return await apiService.createPlayer(`Player${String(Date.now())}`);
+  } catch (err) {
+    if (err instanceof ProblemError && err.code === 'conflict') {
+      return apiService.createPlayer(`Player${String(Date.now())}`);
+    }
+    throw err;
+  }
+};
+
 export const PlayerProvider: React.FC<PlayerProviderProps> = ({ children }) => {
   const [player, setPlayer] = useState<Player | null>(null);
   const [heroes, setHeroes] = useState<Hero[]>([]);
@@ -65,7 +77,7 @@ export const PlayerProvider: React.FC<PlayerProviderProps> = ({ children }) => {
       
       if (!playerId) {
         // No player ID cookie, create a new player
-        const newPlayer = await apiService.createPlayer(`Player${String(Date.now())}`);
+        const newPlayer = await createGeneratedPlayer();
         setPlayer(newPlayer);
         currentPlayer = newPlayer;
       } else {
@@ -76,7 +88,7 @@ export const PlayerProvider: React.FC<PlayerProviderProps> = ({ children }) => {
           currentPlayer = existingPlayer;
         } catch (_err) {
           // Session invalid or expired, create a new player
-          const newPlayer = await apiService.createPlayer(`Player${String(Date.now())}`);
+          const newPlayer = await createGeneratedPlayer();
           setPlayer(newPlayer);
           currentPlayer = newPlayer;
         }
@@ -1,7 +1,37 @@
-import type { Hero, Player, FightResult, FightsResponse, Fight } from '../types/api';
+import type { Hero, Player, FightResult, FightsResponse, Fight, Problem, ProblemCode } from '../types/api';
 import { mockApiService } from './mockApi';
 
 
+// ProblemError is thrown for a failing API request, code is set when the server answered with problem details
+export class ProblemError extends Error {
+  readonly status: number;
+  readonly code: ProblemCode | undefined;
+  readonly retryAfter: number | undefined;
+
+  constructor(message: string, status: number, code?: ProblemCode, retryAfter?: number) {
+    super(message);
+    this.name = 'ProblemError';
+    this.status = status;
+    this.code = code;
+    this.retryAfter = retryAfter;
+  }
+}
+
+// problemError reads the problem details of a failed response, falling back to the status text
+async function problemError(response: Response, action: string): Promise<ProblemError> {
+  const header = response.headers.get('Retry-After');
+  const retryAfter = header ? Number(header) || undefined : undefined;
+  if (response.headers.get('Content-Type')?.startsWith('application/problem+json')) {
+    try {
+      const problem = await response.json() as Problem;
+      return new ProblemError(`${action}: ${problem.detail ?? problem.title}`, response.status, problem.code, problem.retryAfter ?? retryAfter);
+    } catch (_err) {
+      // not valid JSON, report the status below
+    }
+  }
+  return new ProblemError(`${action}: ${response.statusText}`, response.status, undefined, retryAfter);
+}
+
 interface CreateHeroRequest {
   title: string;
   description: string;
@@ -42,7 +72,7 @@ class ApiService {
     const secret = this.getCookieSecret();
     
     if (requireAuth && !secret) {
-      throw new Error('Authentication required - no player_secret cookie found');
+      throw new ProblemError('Authentication required - no player_secret cookie found', 401, 'unauthorized');
     }
 
     const body: Record<string, unknown> = options.body ? JSON.parse(options.body as string) as Record<string, unknown> : {};
@@ -68,7 +98,7 @@ class ApiService {
     if (this.useMockApi) {
       return mockApiService.createPlayer(username);
     }
-    const response = await fetch(`/api/player`, {
+    const response = await fetch(`/api/v1/player`, {
       method: 'POST',
       headers: this.getHeaders(false),
       body: JSON.stringify({ username }),
@@ -76,7 +106,7 @@ class ApiService {
     });
 
     if (!response.ok) {
-      throw new Error(`Failed to create player: ${response.statusText}`);
+      throw await problemError(response, 'Failed to create player');
     }
 
     return response.json() as Promise<Player>;
@@ -86,14 +116,14 @@ class ApiService {
     if (this.useMockApi) {
       return mockApiService.getPlayer(id);
     }
-    const response = await fetch(`/api/player/${id}`, {
+    const response = await fetch(`/api/v1/player/${id}`, {
       method: 'GET',
       headers: this.getHeaders(),
       credentials: 'include', // This will send HttpOnly cookies automatically
     });
 
     if (!response.ok) {
-      throw new Error(`Failed to get player: ${response.statusText}`);
+      throw await problemError(response, 'Failed to get player');
     }
 
     return response.json() as Promise<Player>;
@@ -104,7 +134,7 @@ class ApiService {
     if (this.useMockApi) {
       return mockApiService.createHero(heroData);
     }
-    const response = await fetch(`/api/hero`, {
+    const response = await fetch(`/api/v1/hero`, {
       method: 'POST',
       headers: this.getHeaders(false),
       body: JSON.stringify(heroData),
@@ -112,7 +142,7 @@ class ApiService {
     });
 
     if (!response.ok) {
-      throw new Error(`Failed to create hero: ${response.statusText}`);
+      throw await problemError(response, 'Failed to create hero');
     }
 
     return response.json() as Promise<Hero>;
@@ -122,12 +152,12 @@ class ApiService {
     if (this.useMockApi) {
       return mockApiService.getHero(id);
     }
-    const response = await this.makeAuthenticatedRequest(`/api/hero/${id}`, {
+    const response = await this.makeAuthenticatedRequest(`/api/v1/hero/${id}`, {
       method: 'GET',
     });
 
     if (!response.ok) {
-      throw new Error(`Failed to get hero: ${response.statusText}`);
+      throw await problemError(response, 'Failed to get hero');
     }
 
     return response.json() as Promise<Hero>;
@@ -137,12 +167,12 @@ class ApiService {
     if (this.useMockApi) {
       return mockApiService.getHeroImage(id);
     }
-    const response = await fetch(`/api/hero/${id}/image`, {
+    const response = await fetch(`/api/v1/hero/${id}/image`, {
       credentials: 'include',
     });
 
     if (!response.ok) {
-      throw new Error(`Failed to get hero image: ${response.statusText}`);
+      throw await problemError(response, 'Failed to get hero image');
     }
 
     const blob = await response.blob();
@@ -154,14 +184,14 @@ class ApiService {
     if (this.useMockApi) {
       return mockApiService.startFight(heroId);
     }
-    const response = await fetch(`/api/hero/${heroId}/fight`, {
+    const response = await fetch(`/api/v1/hero/${heroId}/fight`, {
       method: 'POST',
       headers: this.getHeaders(),
       credentials: 'include', // This will send HttpOnly cookies automatically
     });
 
     if (!response.ok) {
-      throw new Error(`Failed to start fight: ${response.statusText}`);
+      throw await problemError(response, 'Failed to start fight');
     }
 
     return response.json() as Promise<FightResult>;
@@ -174,24 +204,24 @@ class ApiService {
     }
     params.append('limit', limit.toString());
 
-    const response = await fetch(`/api/hero/${heroId}/fights?${params}`, {
+    const response = await fetch(`/api/v1/hero/${heroId}/fights?${params}`, {
       credentials: 'include',
     });
 
     if (!response.ok) {
-      throw new Error(`Failed to get hero fights: ${response.statusText}`);
+      throw await problemError(response, 'Failed to get hero fights');
     }
 
     return response.json() as Promise<FightsResponse>;
   }
 
   async getFight(heroId: string, fightId: string): Promise<Fight> {
-    const response = await fetch(`/api/hero/${heroId}/fight/${fightId}`, {
+    const response = await fetch(`/api/v1/hero/${heroId}/fight/${fightId}`, {
       credentials: 'include',
     });
 
     if (!response.ok) {
-      throw new Error(`Failed to get fight: ${response.statusText}`);
+      throw await problemError(response, 'Failed to get fight');
     }
 
     return response.json() as Promise<Fight>;
@@ -202,14 +232,14 @@ class ApiService {
     if (this.useMockApi) {
       return mockApiService.getPlayerHeroes(playerId);
     }
-    const response = await fetch(`/api/player/${playerId}/heroes`, {
+    const response = await fetch(`/api/v1/player/${playerId}/heroes`, {
       method: 'GET',
       headers: this.getHeaders(),
       credentials: 'include', // This will send HttpOnly cookies automatically
     });
 
     if (!response.ok) {
-      throw new Error(`Failed to get player heroes: ${response.statusText}`);
+      throw await problemError(response, 'Failed to get player heroes');
     }
 
     return response.json() as Promise<Hero[]>;
@@ -6,7 +6,6 @@ const mockPlayers: Player[] = [
     ID: '1',
     UserName: 'Player',
     UserNameSuffix: 1234,
-    Secret: 'mock-secret-123',
     DeletedAt: null
   }
 ];
@@ -143,12 +142,11 @@ export class MockApiService {
       ID: '1',
       UserName: username,
       UserNameSuffix: Math.floor(Math.random() * 9999) + 1,
-      Secret: `mock-secret-${Date.now()}`,
       DeletedAt: null
     };
     
     // Set cookie to simulate authentication
-    this.setCookie('player_secret', player.Secret);
+    this.setCookie('player_secret', `mock-secret-${Date.now()}`);
     
     // Update mock data
     mockPlayers[0] = player;
@@ -2,7 +2,6 @@ export interface Player {
   ID: string;
   UserName: string;
   UserNameSuffix: number;
-  Secret: string;
   DeletedAt?: string | null;
 }
 
@@ -42,4 +41,26 @@ export interface FightsResponse {
 
 export interface SecretRequest {
   _secret: string;
-}
\ No newline at end of file
+}
+export type ProblemCode =
+  | 'invalid_request'
+  | 'unauthorized'
+  | 'forbidden'
+  | 'not_found'
+  | 'method_not_allowed'
+  | 'conflict'
+  | 'rate_limited'
+  | 'internal'
+  | 'upstream_unavailable'
+  | 'unavailable';
+
+// RFC 7807 problem details returned by every failing API request
+export interface Problem {
+  type: string;
+  title: string;
+  status: number;
+  detail?: string;
+  instance?: string;
+  code: ProblemCode;
+  retryAfter?: number;
+}